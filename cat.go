@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"golang.org/x/text/encoding"
+)
+
+func catEntry(ctx context.Context, w io.Writer, filePath string, password string, name string, nameEncoding encoding.Encoding) error {
+	zipReader, err := openZipFile(filePath, false)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	_, err = decodeEntryNames(zipReader.File, nameEncoding)
+	if err != nil {
+		return fmt.Errorf("failed to read zip file '%s': %w", filePath, err)
+	}
+
+	zipEntry, err := findZipEntry(zipReader.File, name)
+	if err != nil {
+		return fmt.Errorf("failed to find zip entry in file '%s': %w", filePath, err)
+	}
+
+	zipEntryReader, err := openZipEntry(zipEntry, password)
+	if err != nil {
+		return err
+	}
+	defer zipEntryReader.Close()
+	srcReader := bufio.NewReaderSize(newContextReader(ctx, zipEntryReader), defaultBufSize)
+
+	_, err = io.Copy(w, srcReader)
+	if err != nil {
+		return fmt.Errorf("failed to copy zip entry '%s': %w", zipEntry.Name, err)
+	}
+	return nil
+}
+
+func findZipEntry(files []*zip.File, name string) (*zip.File, error) {
+	for _, file := range files {
+		if file.Name == name && !file.FileInfo().IsDir() {
+			return file, nil
+		}
+	}
+	var matches []*zip.File
+	for _, file := range files {
+		if !file.FileInfo().IsDir() && matchPattern(name, file.Name) {
+			matches = append(matches, file)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no zip entry matches '%s'", name)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match.Name)
+	}
+	return nil, fmt.Errorf("multiple zip entries match '%s': %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatEntry(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "logs/security.evtx", content: "security"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	filePath := createTestZipFile(t, entries, "password_1")
+
+	tests := []struct {
+		name      string
+		entry     string
+		password  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "with an exact name",
+			entry:    "logs/system.evtx",
+			password: "password_1",
+			expected: "system",
+		},
+		{
+			name:     "with a glob matching a single entry",
+			entry:    "*.txt",
+			password: "password_1",
+			expected: "readme",
+		},
+		{
+			name:      "with a glob matching multiple entries",
+			entry:     "*.evtx",
+			password:  "password_1",
+			expectErr: true,
+		},
+		{
+			name:      "with a non-existing entry",
+			entry:     "logs/application.evtx",
+			password:  "password_1",
+			expectErr: true,
+		},
+		{
+			name:      "with a dir entry",
+			entry:     "logs/",
+			password:  "password_1",
+			expectErr: true,
+		},
+		{
+			name:      "with a wrong password",
+			entry:     "logs/system.evtx",
+			password:  "password_2",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := catEntry(context.Background(), &buf, filePath, tt.password, tt.entry, nil)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
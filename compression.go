@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/binalyze/biunzip/internal/deflate64"
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	methodDeflate64      = 9
+	methodBzip2          = 12
+	methodLZMA           = 14
+	methodZstd           = 93
+	methodXZ             = 95
+	methodZstdDeprecated = 20
+
+	lzmaPropsSize = 5
+)
+
+var compressionMethodNames = map[uint16]string{
+	zip.Store:            "store",
+	1:                    "shrink",
+	6:                    "implode",
+	zip.Deflate:          "deflate",
+	methodDeflate64:      "deflate64",
+	methodBzip2:          "bzip2",
+	methodLZMA:           "lzma",
+	methodZstdDeprecated: "zstd",
+	methodZstd:           "zstd",
+	methodXZ:             "xz",
+	96:                   "jpeg",
+	97:                   "wavpack",
+	98:                   "ppmd",
+}
+
+var errInvalidLZMAHeader = errors.New("invalid lzma header")
+
+// decompressors are registered to the zip package in addition to store and
+// deflate, and used to unzip streams.
+var decompressors = map[uint16]zip.Decompressor{
+	methodDeflate64:      deflate64.NewReader,
+	methodBzip2:          newBzip2Reader,
+	methodZstdDeprecated: newZstdReader,
+	methodZstd:           newZstdReader,
+	methodXZ:             newXZReader,
+}
+
+func init() {
+	for method, decompressor := range decompressors {
+		zip.RegisterDecompressor(method, decompressor)
+	}
+	zip.RegisterSizedDecompressor(methodLZMA, newLZMAReader)
+}
+
+// findDecompressor returns the decompressor of the method for an entry with
+// the uncompressed size.
+func findDecompressor(method uint16, size uint64) zip.Decompressor {
+	switch method {
+	case zip.Store:
+		return io.NopCloser
+	case zip.Deflate:
+		return flate.NewReader
+	case methodLZMA:
+		return func(r io.Reader) io.ReadCloser {
+			return newLZMAReader(r, size)
+		}
+	}
+	return decompressors[method]
+}
+
+func compressionMethodName(method uint16) string {
+	name, ok := compressionMethodNames[method]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+func newBzip2Reader(r io.Reader) io.ReadCloser {
+	return io.NopCloser(bzip2.NewReader(r))
+}
+
+func makeUnsupportedMethodErr(zipEntry *zip.File) error {
+	return fmt.Errorf("failed to open zip entry '%s': unsupported compression method %d (%s)", zipEntry.Name, zipEntry.Method, compressionMethodName(zipEntry.Method))
+}
+
+// newLZMAReader converts the zip lzma header, which is a version, the size of
+// the properties and the properties, to the classic lzma header with the
+// uncompressed size, so the stream may end with or without an end marker.
+func newLZMAReader(r io.Reader, size uint64) io.ReadCloser {
+	header := make([]byte, 4+lzmaPropsSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return newErrReader(fmt.Errorf("failed to read lzma header: %w", err))
+	}
+	if binary.LittleEndian.Uint16(header[2:]) != lzmaPropsSize {
+		return newErrReader(errInvalidLZMAHeader)
+	}
+	classicHeader := binary.LittleEndian.AppendUint64(header[4:], size)
+	reader, err := lzma.NewReader(io.MultiReader(bytes.NewReader(classicHeader), r))
+	if err != nil {
+		return newErrReader(fmt.Errorf("failed to read lzma header: %w", err))
+	}
+	return io.NopCloser(reader)
+}
+
+func newZstdReader(r io.Reader) io.ReadCloser {
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return newErrReader(fmt.Errorf("failed to read zstd header: %w", err))
+	}
+	return decoder.IOReadCloser()
+}
+
+func newXZReader(r io.Reader) io.ReadCloser {
+	reader, err := xz.NewReader(r)
+	if err != nil {
+		return newErrReader(fmt.Errorf("failed to read xz header: %w", err))
+	}
+	return io.NopCloser(reader)
+}
+
+type errReader struct {
+	err error
+}
+
+func newErrReader(err error) io.ReadCloser {
+	return errReader{err: err}
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func (r errReader) Close() error {
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// testBzip2Content is "bzip2 content" compressed with bzip2, since the
+// standard library can only decompress bzip2.
+var testBzip2Content = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x88, 0xd8, 0x77, 0x6e, 0x00, 0x00,
+	0x01, 0x19, 0x80, 0x40, 0x00, 0x10, 0x00, 0x1a, 0x21, 0xc4, 0x10, 0x20, 0x00, 0x22, 0x00, 0x31,
+	0x08, 0x06, 0x9a, 0x68, 0x80, 0x6a, 0x17, 0x20, 0x53, 0x2f, 0x17, 0x72, 0x45, 0x38, 0x50, 0x90,
+	0x88, 0xd8, 0x77, 0x6e,
+}
+
+func TestUnzipFileWithCompressionMethods(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     uint16
+		flags      uint16
+		content    string
+		compressed []byte
+	}{
+		{
+			name:       "with bzip2",
+			method:     methodBzip2,
+			content:    "bzip2 content",
+			compressed: testBzip2Content,
+		},
+		{
+			name:       "with lzma",
+			method:     methodLZMA,
+			flags:      0x2,
+			content:    "lzma content",
+			compressed: compressTestLZMA(t, "lzma content", true),
+		},
+		{
+			name:       "with lzma without an end marker",
+			method:     methodLZMA,
+			content:    "lzma content",
+			compressed: compressTestLZMA(t, "lzma content", false),
+		},
+		{
+			name:       "with deflate64",
+			method:     methodDeflate64,
+			content:    "deflate64 content",
+			compressed: compressTestDeflate(t, "deflate64 content"),
+		},
+		{
+			name:       "with xz",
+			method:     methodXZ,
+			content:    "xz content",
+			compressed: compressTestXZ(t, "xz content"),
+		},
+		{
+			name:       "with zstd",
+			method:     methodZstd,
+			content:    "zstd content",
+			compressed: compressTestZstd(t, "zstd content"),
+		},
+		{
+			name:       "with deprecated zstd",
+			method:     methodZstdDeprecated,
+			content:    "zstd content",
+			compressed: compressTestZstd(t, "zstd content"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &zip.FileHeader{
+				Name:   "file_1.txt",
+				Method: tt.method,
+				Flags:  tt.flags,
+			}
+			filePath := createRawTestZipFile(t, header, tt.content, tt.compressed)
+			err := unzipFile(context.Background(), filePath, "", unzipOptions{logWriter: &bytes.Buffer{}})
+			require.NoError(t, err)
+			requireDirContent(t, makeDirPath(filePath), map[string]string{"file_1.txt": tt.content})
+		})
+	}
+}
+
+func TestUnzipFileWithUnsupportedMethod(t *testing.T) {
+	header := &zip.FileHeader{
+		Name:   "file_1.txt",
+		Method: 98,
+	}
+	filePath := createRawTestZipFile(t, header, "content", []byte("content"))
+	err := unzipFile(context.Background(), filePath, "", unzipOptions{logWriter: &bytes.Buffer{}})
+	require.ErrorContains(t, err, "unsupported compression method 98 (ppmd)")
+}
+
+func TestCompressionMethodName(t *testing.T) {
+	require.Equal(t, "deflate", compressionMethodName(8))
+	require.Equal(t, "zstd", compressionMethodName(93))
+	require.Equal(t, "unknown", compressionMethodName(1000))
+}
+
+func createRawTestZipFile(t *testing.T, header *zip.FileHeader, content string, compressed []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	header.CRC32 = crc32.ChecksumIEEE([]byte(content))
+	header.UncompressedSize64 = uint64(len(content))
+	header.CompressedSize64 = uint64(len(compressed))
+	writer := zip.NewWriter(file)
+	entryWriter, err := writer.CreateRaw(header)
+	require.NoError(t, err)
+	_, err = entryWriter.Write(compressed)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return filePath
+}
+
+// compressTestLZMA writes the zip lzma header, which is a version, the size
+// of the properties and the properties, followed by the lzma stream.
+func compressTestLZMA(t *testing.T, content string, eosMarker bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	config := lzma.WriterConfig{EOSMarker: true, Size: -1}
+	if !eosMarker {
+		config = lzma.WriterConfig{Size: int64(len(content))}
+	}
+	writer, err := config.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	stream := buf.Bytes()
+	compressed := []byte{9, 20, lzmaPropsSize, 0}
+	compressed = append(compressed, stream[:lzmaPropsSize]...)
+	return append(compressed, stream[lzma.HeaderLen:]...)
+}
+
+// compressTestDeflate compresses the content with deflate, which is read as
+// deflate64 as long as no match is 258 bytes long.
+func compressTestDeflate(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func compressTestXZ(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := xz.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func compressTestZstd(t *testing.T, content string) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer encoder.Close()
+	return encoder.EncodeAll([]byte(content), nil)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	defaultCSVDelimiter = ','
+	csvBufSize          = 64 * 1024 // 64KB
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+
+	csvDelimiterCandidates = []rune{',', ';', '\t', '|'}
+
+	errOddUTF16ByteCount = errors.New("odd byte count for utf-16 data")
+)
+
+type csvFileReader struct {
+	file    *os.File
+	reader  *csv.Reader
+	lineNum int
+}
+
+func openCSVFile(csvFilePath string, delimiter rune, fieldsPerRecord int) (*csvFileReader, error) {
+	file, err := os.Open(csvFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open csv file: %w", err)
+	}
+	reader, err := newCSVReader(file, delimiter)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to decode csv file: %w", err)
+	}
+	reader.FieldsPerRecord = fieldsPerRecord
+	csvReader := &csvFileReader{
+		file:   file,
+		reader: reader,
+	}
+	return csvReader, nil
+}
+
+func (r *csvFileReader) read() ([]string, error) {
+	line, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv file: %w", err)
+	}
+	r.lineNum++
+	return line, nil
+}
+
+func (r *csvFileReader) close() error {
+	return r.file.Close()
+}
+
+func newCSVReader(r io.Reader, delimiter rune) (*csv.Reader, error) {
+	dataReader, err := newCSVDataReader(bufio.NewReaderSize(r, csvBufSize))
+	if err != nil {
+		return nil, err
+	}
+	bufReader := bufio.NewReaderSize(dataReader, csvBufSize)
+	if delimiter == 0 {
+		data, err := bufReader.Peek(csvBufSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		delimiter = detectCSVDelimiter(data)
+	}
+	reader := csv.NewReader(bufReader)
+	reader.Comma = delimiter
+	return reader, nil
+}
+
+func newCSVDataReader(r *bufio.Reader) (io.Reader, error) {
+	prefix, err := r.Peek(len(utf8BOM))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(prefix, utf8BOM):
+		_, err = r.Discard(len(utf8BOM))
+		return r, err
+	case bytes.HasPrefix(prefix, utf16LEBOM):
+		_, err = r.Discard(len(utf16LEBOM))
+		return newUTF16Reader(r, binary.LittleEndian), err
+	case bytes.HasPrefix(prefix, utf16BEBOM):
+		_, err = r.Discard(len(utf16BEBOM))
+		return newUTF16Reader(r, binary.BigEndian), err
+	}
+	return r, nil
+}
+
+type utf16Reader struct {
+	reader *bufio.Reader
+	order  binary.ByteOrder
+	buf    []byte
+	unit   []byte
+}
+
+func newUTF16Reader(r *bufio.Reader, order binary.ByteOrder) io.Reader {
+	return &utf16Reader{
+		reader: r,
+		order:  order,
+		unit:   make([]byte, 2),
+	}
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) {
+		unit, err := r.readUnit()
+		if err == io.EOF && len(r.buf) > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		char := rune(unit)
+		if utf16.IsSurrogate(char) {
+			next, err := r.readUnit()
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+			char = utf16.DecodeRune(char, rune(next))
+		}
+		r.buf = utf8.AppendRune(r.buf, char)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *utf16Reader) readUnit() (uint16, error) {
+	_, err := io.ReadFull(r.reader, r.unit)
+	if err == io.ErrUnexpectedEOF {
+		return 0, errOddUTF16ByteCount
+	}
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint16(r.unit), nil
+}
+
+func detectCSVDelimiter(data []byte) rune {
+	counts := make(map[rune]int)
+	inQuotes := false
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		if r == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if inQuotes {
+			continue
+		}
+		if r == '\n' || r == '\r' {
+			break
+		}
+		counts[r]++
+	}
+	delimiter := rune(defaultCSVDelimiter)
+	maxCount := 0
+	for _, candidate := range csvDelimiterCandidates {
+		if counts[candidate] > maxCount {
+			delimiter = candidate
+			maxCount = counts[candidate]
+		}
+	}
+	return delimiter
+}
+
+func parseCSVDelimiter(value string) (rune, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid csv delimiter '%s'", value)
+	}
+	return r, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCSVDataReader(t *testing.T) {
+	expected := []byte("File Name,Zip Password\n")
+	tests := []struct {
+		name      string
+		data      []byte
+		expectErr bool
+	}{
+		{
+			name: "without a bom",
+			data: []byte("File Name,Zip Password\n"),
+		},
+		{
+			name: "with a utf-8 bom",
+			data: []byte("\xEF\xBB\xBFFile Name,Zip Password\n"),
+		},
+		{
+			name: "with a utf-16le bom",
+			data: []byte("\xFF\xFEF\x00i\x00l\x00e\x00 \x00N\x00a\x00m\x00e\x00,\x00Z\x00i\x00p\x00 \x00P\x00a\x00s\x00s\x00w\x00o\x00r\x00d\x00\n\x00"),
+		},
+		{
+			name: "with a utf-16be bom",
+			data: []byte("\xFE\xFF\x00F\x00i\x00l\x00e\x00 \x00N\x00a\x00m\x00e\x00,\x00Z\x00i\x00p\x00 \x00P\x00a\x00s\x00s\x00w\x00o\x00r\x00d\x00\n"),
+		},
+		{
+			name:      "with truncated utf-16 data",
+			data:      []byte("\xFF\xFEF\x00i"),
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newCSVDataReader(bufio.NewReader(bytes.NewReader(tt.data)))
+			require.NoError(t, err)
+			actual, err := io.ReadAll(reader)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestDetectCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected rune
+	}{
+		{
+			name:     "with a comma delimiter",
+			data:     "File Name,Zip Password\nfile_1.zip,password_1\n",
+			expected: ',',
+		},
+		{
+			name:     "with a semicolon delimiter",
+			data:     "File Name;Zip Password\r\nfile_1.zip;password_1\r\n",
+			expected: ';',
+		},
+		{
+			name:     "with a tab delimiter",
+			data:     "File Name\tZip Password\n",
+			expected: '\t',
+		},
+		{
+			name:     "with a quoted delimiter",
+			data:     "\"File;Name\",Zip Password\n",
+			expected: ',',
+		},
+		{
+			name:     "without a delimiter",
+			data:     "File Name\n",
+			expected: ',',
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := detectCSVDelimiter([]byte(tt.data))
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  rune
+		expectErr bool
+	}{
+		{
+			name:     "with an empty value",
+			value:    "",
+			expected: 0,
+		},
+		{
+			name:     "with a semicolon",
+			value:    ";",
+			expected: ';',
+		},
+		{
+			name:     "with tab",
+			value:    "tab",
+			expected: '\t',
+		},
+		{
+			name:      "with multiple characters",
+			value:     ";;",
+			expectErr: true,
+		},
+		{
+			name:      "with a quote",
+			value:     `"`,
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := parseCSVDelimiter(tt.value)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
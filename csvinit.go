@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	sizeColName    = "Size"
+	modTimeColName = "Modification Time"
+	sha256ColName  = "SHA-256"
+)
+
+func initCSVFile(ctx context.Context, dirPath string, csvFilePath string, recursive bool) error {
+	paths, err := findDirZipFiles(dirPath, recursive)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no zip files found in dir '%s'", dirPath)
+	}
+
+	if csvFilePath == "-" {
+		return writeCSVFile(ctx, os.Stdout, dirPath, paths)
+	}
+	// the csv file is removed if it can't be completed, so a partial csv file
+	// isn't left behind to block the next run.
+	file, err := os.OpenFile(csvFilePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) // 0644: rw-r--r--
+	if err != nil {
+		return fmt.Errorf("failed to create csv file: %w", err)
+	}
+	err = writeCSVFile(ctx, file, dirPath, paths)
+	closeErr := file.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close csv file: %w", closeErr)
+	}
+	if err != nil {
+		_ = os.Remove(csvFilePath)
+		return err
+	}
+	return nil
+}
+
+func writeCSVFile(ctx context.Context, output io.Writer, dirPath string, paths []string) error {
+	writer := csv.NewWriter(output)
+	err := writer.Write([]string{filenameColName, passwordColName, sizeColName, modTimeColName, sha256ColName})
+	if err != nil {
+		return fmt.Errorf("failed to write csv file: %w", err)
+	}
+	for _, path := range paths {
+		line, err := makeCSVLine(ctx, dirPath, path)
+		if err != nil {
+			return err
+		}
+		err = writer.Write(line)
+		if err != nil {
+			return fmt.Errorf("failed to write csv file: %w", err)
+		}
+	}
+	writer.Flush()
+	err = writer.Error()
+	if err != nil {
+		return fmt.Errorf("failed to write csv file: %w", err)
+	}
+	return nil
+}
+
+func makeCSVLine(ctx context.Context, dirPath string, path string) ([]string, error) {
+	filename, err := filepath.Rel(dirPath, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relative path for '%s': %w", path, err)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info for '%s': %w", path, err)
+	}
+	hash, err := hashFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	line := []string{
+		filepath.ToSlash(filename),
+		"",
+		strconv.FormatInt(fileInfo.Size(), 10),
+		fileInfo.ModTime().UTC().Format(time.RFC3339),
+		hash,
+	}
+	return line, nil
+}
+
+func hashFile(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file '%s': %w", path, err)
+	}
+	defer file.Close()
+	return hashReader(ctx, file, path)
+}
+
+func hashReader(ctx context.Context, r io.Reader, path string) (string, error) {
+	hash := sha256.New()
+	_, err := io.CopyBuffer(hash, newContextReader(ctx, r), make([]byte, defaultBufSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file '%s': %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitCSVFile(t *testing.T) {
+	dirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirPath)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, "file_1.zip"), []byte("test"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, "file_2.txt"), []byte("test"), 0644))
+
+	csvFilePath := filepath.Join(dirPath, "files.csv")
+	err = initCSVFile(context.Background(), dirPath, csvFilePath, false)
+	require.NoError(t, err)
+
+	lines, err := readCSVLines(csvFilePath, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	require.Equal(t, []string{filenameColName, passwordColName, sizeColName, modTimeColName, sha256ColName}, lines[0])
+	require.Equal(t, "file_1.zip", lines[1][0])
+	require.Equal(t, "", lines[1][1])
+	require.Equal(t, "4", lines[1][2])
+	require.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", lines[1][4])
+	_, err = validateCSVHeader(lines[0], csvOptions{})
+	require.NoError(t, err)
+	require.Empty(t, validateLines(lines, false).errs())
+
+	err = initCSVFile(context.Background(), dirPath, csvFilePath, false)
+	require.Error(t, err, "existing csv file must not be overwritten")
+	require.FileExists(t, csvFilePath, "existing csv file must not be removed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceledCSVFilePath := filepath.Join(dirPath, "canceled.csv")
+	err = initCSVFile(ctx, dirPath, canceledCSVFilePath, false)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoFileExists(t, canceledCSVFilePath, "partial csv file must be removed")
+	err = initCSVFile(context.Background(), dirPath, canceledCSVFilePath, false)
+	require.NoError(t, err)
+
+	emptyDirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(emptyDirPath)
+
+	err = initCSVFile(context.Background(), emptyDirPath, "-", false)
+	require.Error(t, err)
+}
+
+func TestHashFile(t *testing.T) {
+	filePath, err := createTempFile("", "test*.zip", []byte("test"))
+	require.NoError(t, err)
+	defer os.Remove(filePath)
+
+	actual, err := hashFile(context.Background(), filePath)
+	require.NoError(t, err)
+	require.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", actual)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = hashFile(ctx, filePath)
+	require.ErrorIs(t, err, context.Canceled)
+}
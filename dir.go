@@ -2,12 +2,13 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,208 +19,347 @@ type zipFile struct {
 	password string
 }
 
+type csvOptions struct {
+	delimiter       rune
+	filenameCol     string
+	passwordCol     string
+	allowSubdirs    bool
+	unlistedMode    string
+	defaultPassword string
+}
+
+type csvCols struct {
+	filename int
+	password int
+}
+
 const (
 	filenameColName = "File Name"
 	passwordColName = "Zip Password"
 )
 
-func unzipDir(ctx context.Context, dirPath string, csvFilePath string) error {
-	lines, err := readCSVFile(csvFilePath)
+var errNoCSVData = errors.New("csv file doesn't have any data")
+
+func unzipDir(ctx context.Context, dirPath string, csvFilePath string, opts csvOptions, unzipOpts unzipOptions) error {
+	reader, err := openCSVFile(csvFilePath, opts.delimiter, 0)
 	if err != nil {
 		return err
 	}
+	defer reader.close()
 
-	err = validateCSVFile(lines)
+	header, err := reader.read()
+	if err == io.EOF {
+		return errNoCSVData
+	}
 	if err != nil {
 		return err
 	}
 
-	files := parseZipFiles(dirPath, lines)
-
-	err = validateZipFiles(files)
+	cols, err := validateCSVHeader(header, opts)
 	if err != nil {
 		return err
 	}
 
-	return unzipFiles(ctx, files)
-}
+	// In fail mode nothing is extracted before the whole csv file is validated
+	// and reconciled, otherwise extractions start while the csv file is read.
+	scheduler := newUnzipScheduler(ctx, runtime.NumCPU(), unzipOpts)
+	scheduleEarly := opts.unlistedMode != unlistedModeFail
 
-func readCSVFile(csvFilePath string) ([][]string, error) {
-	file, err := os.Open(csvFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open csv file: %w", err)
+	// Every listed row is reconciled with the dir, so rows that fail to stat
+	// are only reported after the reconciliation warned about them.
+	var valid []zipFile
+	var fileErrs []error
+	files, errs := readZipFiles(reader, dirPath, cols, opts.allowSubdirs, func(file zipFile) {
+		err := validateZipFile(file)
+		if err != nil {
+			fileErrs = append(fileErrs, err)
+			return
+		}
+		if scheduleEarly {
+			scheduler.schedule(file)
+			return
+		}
+		valid = append(valid, file)
+	})
+	if !scheduleEarly && len(errs) > 0 {
+		return joinMultiErrs(errs)
 	}
-	defer file.Close()
-	reader := csv.NewReader(file)
-	lines, err := reader.ReadAll()
+
+	pending, err := reconcileDir(dirPath, files, valid, opts, unzipOpts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read csv file: %w", err)
+		errs = append(errs, err)
+	}
+	if len(fileErrs) > 0 {
+		errs = append(errs, makeMultiErr("failed to validate zip files in csv file", fileErrs))
+	}
+	if !scheduleEarly && len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	for _, file := range pending {
+		scheduler.schedule(file)
 	}
-	return lines, nil
-}
 
-func validateCSVFile(lines [][]string) error {
-	err := validateLineCount(lines)
-	if err != nil {
-		return err
+	errs = append(errs, scheduler.wait()...)
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
 	}
+	return nil
+}
 
-	err = validateHeaderColCount(lines)
-	if err != nil {
-		return err
+func readZipFiles(reader *csvFileReader, dirPath string, cols csvCols, allowSubdirs bool, onFile func(zipFile)) ([]zipFile, []error) {
+	validator := newCSVRowValidator(cols, allowSubdirs)
+	var files []zipFile
+	for {
+		line, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, append(validator.errs(), err)
+		}
+		if !validator.validate(reader.lineNum, line) {
+			continue
+		}
+		file := parseZipFile(dirPath, line, cols)
+		files = append(files, file)
+		onFile(file)
 	}
+	return files, validator.errs()
+}
 
-	err = checkEmptyFilenames(lines)
+func reconcileDir(dirPath string, listed []zipFile, pending []zipFile, opts csvOptions, unzipOpts unzipOptions) ([]zipFile, error) {
+	rec, err := reconcileZipFiles(dirPath, listed, opts.allowSubdirs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = checkDuplicateFilenames(lines)
+	printReconciliation(rec, unzipOpts)
+
+	return applyReconciliation(rec, pending, opts.unlistedMode, opts.defaultPassword)
+}
+
+func readCSVLines(csvFilePath string, delimiter rune, fieldsPerRecord int) ([][]string, error) {
+	reader, err := openCSVFile(csvFilePath, delimiter, fieldsPerRecord)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer reader.close()
+	var lines [][]string
+	for {
+		line, err := reader.read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
 	}
-
-	return nil
 }
 
 func validateLineCount(lines [][]string) error {
 	if len(lines) < 2 {
-		return fmt.Errorf("csv file doesn't have any data")
+		return errNoCSVData
 	}
 	return nil
 }
 
-func validateHeaderColCount(lines [][]string) error {
-	header := lines[0]
+func validateCSVHeader(header []string, opts csvOptions) (csvCols, error) {
+	err := validateHeaderColCount(header)
+	if err != nil {
+		return csvCols{}, err
+	}
+	return findColIndexes(header, opts)
+}
+
+func validateHeaderColCount(header []string) error {
 	if len(header) < 2 {
 		return errors.New("unexpected column count found on header line")
 	}
 	return nil
 }
 
-func checkEmptyFilenames(lines [][]string) error {
-	header := lines[0]
-	filenameColIndex := findFilenameColIndex(header)
-	var invalidLineNums []int
-	for i, line := range lines {
-		filename := line[filenameColIndex]
-		if len(filename) == 0 {
-			invalidLineNums = append(invalidLineNums, i+1)
+type filenameOccurrence struct {
+	lineNum   int
+	duplicate bool
+}
+
+type csvRowValidator struct {
+	cols              csvCols
+	allowSubdirs      bool
+	rowCount          int
+	filenames         map[string]*filenameOccurrence
+	emptyLineNums     []int
+	duplicateLineNums []int
+	insecureLineNums  []int
+}
+
+func newCSVRowValidator(cols csvCols, allowSubdirs bool) *csvRowValidator {
+	return &csvRowValidator{
+		cols:         cols,
+		allowSubdirs: allowSubdirs,
+		filenames:    make(map[string]*filenameOccurrence),
+	}
+}
+
+func (v *csvRowValidator) validate(lineNum int, line []string) bool {
+	v.rowCount++
+	filename := line[v.cols.filename]
+	if len(filename) == 0 {
+		v.emptyLineNums = append(v.emptyLineNums, lineNum)
+		return false
+	}
+	if isInsecureFilename(filename, v.allowSubdirs) {
+		v.insecureLineNums = append(v.insecureLineNums, lineNum)
+		return false
+	}
+	occurrence, ok := v.filenames[filename]
+	if ok {
+		if !occurrence.duplicate {
+			occurrence.duplicate = true
+			v.duplicateLineNums = append(v.duplicateLineNums, occurrence.lineNum)
 		}
+		v.duplicateLineNums = append(v.duplicateLineNums, lineNum)
+		return false
+	}
+	v.filenames[filename] = &filenameOccurrence{lineNum: lineNum}
+	return true
+}
+
+func (v *csvRowValidator) errs() []error {
+	var errs []error
+	if v.rowCount == 0 {
+		errs = append(errs, errNoCSVData)
 	}
-	if len(invalidLineNums) > 0 {
-		return fmt.Errorf("empty filename found on line(s) %s", joinLineNums(invalidLineNums))
+	if len(v.emptyLineNums) > 0 {
+		errs = append(errs, fmt.Errorf("empty filename found on line(s) %s", joinLineNums(v.emptyLineNums)))
 	}
-	return nil
+	if len(v.duplicateLineNums) > 0 {
+		sort.Ints(v.duplicateLineNums)
+		errs = append(errs, fmt.Errorf("duplicate filenames found on lines %s", joinLineNums(v.duplicateLineNums)))
+	}
+	if len(v.insecureLineNums) > 0 {
+		errs = append(errs, fmt.Errorf("insecure filename found on line(s) %s", joinLineNums(v.insecureLineNums)))
+	}
+	return errs
 }
 
-func checkDuplicateFilenames(lines [][]string) error {
-	header := lines[0]
-	filenameColIndex := findFilenameColIndex(header)
-	var duplicateLineNums []int
-	for i := 0; i < len(lines); i++ {
-		lineNum := i + 1
-		if lineNumExists(lineNum, duplicateLineNums) {
-			continue
-		}
-		filename := lines[i][filenameColIndex]
-		for j := i + 1; j < len(lines); j++ {
-			existingLineNum := j + 1
-			if lineNumExists(existingLineNum, duplicateLineNums) {
-				continue
-			}
-			existingFilaname := lines[j][filenameColIndex]
-			if filename == existingFilaname {
-				if !lineNumExists(lineNum, duplicateLineNums) {
-					duplicateLineNums = append(duplicateLineNums, lineNum)
-				}
-				duplicateLineNums = append(duplicateLineNums, existingLineNum)
-			}
-		}
+func isInsecureFilename(filename string, allowSubdirs bool) bool {
+	if !filepath.IsLocal(filename) || strings.Contains(filename, `\`) {
+		return true
 	}
-	if len(duplicateLineNums) > 0 {
-		return fmt.Errorf("duplicate filenames found on lines %s", joinLineNums(duplicateLineNums))
+	return !allowSubdirs && strings.Contains(filename, "/")
+}
+
+func parseZipFile(dirPath string, line []string, cols csvCols) zipFile {
+	return zipFile{
+		path:     filepath.Join(dirPath, line[cols.filename]),
+		password: line[cols.password],
+	}
+}
+
+func validateZipFile(file zipFile) error {
+	fileInfo, err := os.Stat(file.path)
+	if err != nil {
+		return fmt.Errorf("failed to get file info for '%s': %w", file.path, err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return fmt.Errorf("'%s' is not a regular file", file.path)
+	}
+	_, _, err = findVolumePaths(file.path)
+	if err != nil {
+		return fmt.Errorf("failed to find volumes of '%s': %w", file.path, err)
 	}
 	return nil
 }
 
-func parseZipFiles(dirPath string, lines [][]string) []zipFile {
-	header := lines[0]
-	filenameColIndex := findFilenameColIndex(header)
-	passwordColIndex := findPasswordColIndex(header)
-	var files []zipFile
-	for i := 1; i < len(lines); i++ {
-		line := lines[i]
-		filename := line[filenameColIndex]
-		filePath := filepath.Join(dirPath, filename)
-		password := line[passwordColIndex]
-		file := zipFile{
-			path:     filePath,
-			password: password,
-		}
-		files = append(files, file)
+type unzipScheduler struct {
+	ctx  context.Context
+	opts unzipOptions
+	sem  semphore
+	mu   sync.Mutex
+	errs []error
+}
+
+func newUnzipScheduler(ctx context.Context, maxConcurrency int, opts unzipOptions) *unzipScheduler {
+	return &unzipScheduler{
+		ctx:  ctx,
+		opts: opts,
+		sem:  newSemaphore(maxConcurrency),
 	}
-	return files
 }
 
-func validateZipFiles(files []zipFile) error {
-	var errs []error
-	for _, file := range files {
-		fileInfo, err := os.Stat(file.path)
+func (s *unzipScheduler) schedule(file zipFile) {
+	s.sem.acquire()
+	go func() {
+		defer s.sem.release()
+		err := unzipFile(s.ctx, file.path, file.password, s.opts)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to get file info for '%s': %w", file.path, err))
-			continue
-		}
-		if !fileInfo.Mode().IsRegular() {
-			errs = append(errs, fmt.Errorf("'%s' is not a regular file", file.path))
+			s.mu.Lock()
+			s.errs = append(s.errs, err)
+			s.mu.Unlock()
 		}
+	}()
+}
+
+func (s *unzipScheduler) wait() []error {
+	s.sem.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errs
+}
+
+func findColIndexes(header []string, opts csvOptions) (csvCols, error) {
+	var cols csvCols
+	var err error
+	cols.filename, err = findFilenameColIndex(header, opts.filenameCol)
+	if err != nil {
+		return csvCols{}, err
 	}
-	if len(errs) > 0 {
-		return makeMultiErr("failed to validate zip files in csv file", errs)
+	cols.password, err = findPasswordColIndex(header, opts.passwordCol)
+	if err != nil {
+		return csvCols{}, err
 	}
-	return nil
+	return cols, nil
 }
 
-func unzipFiles(ctx context.Context, files []zipFile) error {
-	var mu sync.Mutex
-	var errs []error
-	maxConcurrency := runtime.NumCPU()
-	sem := newSemaphore(maxConcurrency)
-	for _, file := range files {
-		sem.acquire()
-		go func(filePath string, password string) {
-			err := unzipFile(ctx, filePath, password)
-			if err != nil {
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			}
-			sem.release()
-		}(file.path, file.password)
-	}
-	sem.wait()
-	if len(errs) > 0 {
-		return joinMultiErrs(errs)
+func findFilenameColIndex(header []string, col string) (int, error) {
+	if len(col) > 0 {
+		return findColIndex(header, col)
 	}
-	return nil
+	i, err := findColIndex(header, filenameColName)
+	if err != nil {
+		return 0, nil
+	}
+	return i, nil
 }
 
-func findFilenameColIndex(header []string) int {
-	for i, col := range header {
-		if col == filenameColName {
-			return i
-		}
+func findPasswordColIndex(header []string, col string) (int, error) {
+	if len(col) > 0 {
+		return findColIndex(header, col)
 	}
-	return 0
+	i, err := findColIndex(header, passwordColName)
+	if err != nil {
+		return len(header) - 1, nil
+	}
+	return i, nil
 }
 
-func findPasswordColIndex(header []string) int {
-	for i, col := range header {
-		if col == passwordColName {
-			return i
+func findColIndex(header []string, col string) (int, error) {
+	for i, name := range header {
+		if matchColName(name, col) {
+			return i, nil
 		}
 	}
-	return len(header) - 1
+	colNum, err := strconv.Atoi(col)
+	if err == nil && colNum >= 1 && colNum <= len(header) {
+		return colNum - 1, nil
+	}
+	return 0, fmt.Errorf("column '%s' not found on header line", col)
+}
+
+func matchColName(name string, col string) bool {
+	return strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(col))
 }
 
 func joinLineNums(lineNums []int) string {
@@ -232,12 +372,3 @@ func joinLineNums(lineNums []int) string {
 	}
 	return builder.String()
 }
-
-func lineNumExists(lineNum int, lineNums []int) bool {
-	for _, existingLineNum := range lineNums {
-		if lineNum == existingLineNum {
-			return true
-		}
-	}
-	return false
-}
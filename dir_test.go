@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
-func TestReadCSVFile(t *testing.T) {
+func TestReadCSVLines(t *testing.T) {
 	validLines := [][]string{
 		{filenameColName, passwordColName},
 		{"file_1.zip", "password_1"},
@@ -23,6 +30,10 @@ func TestReadCSVFile(t *testing.T) {
 	require.NoError(t, err)
 	defer os.Remove(invalidCSVFilePath)
 
+	excelCSVFilePath, err := createTempFile("", "test*.csv", []byte("\xEF\xBB\xBFFile Name;Zip Password\r\nfile_1.zip;password_1\r\nfile_2.zip;password_2\r\n"))
+	require.NoError(t, err)
+	defer os.Remove(excelCSVFilePath)
+
 	tests := []struct {
 		name      string
 		path      string
@@ -35,6 +46,12 @@ func TestReadCSVFile(t *testing.T) {
 			expected:  validLines,
 			expectErr: false,
 		},
+		{
+			name:      "with an excel csv file",
+			path:      excelCSVFilePath,
+			expected:  validLines,
+			expectErr: false,
+		},
 		{
 			name:      "with a non-existent csv file",
 			path:      "non-existing_file.csv",
@@ -50,7 +67,7 @@ func TestReadCSVFile(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := readCSVFile(tt.path)
+			actual, err := readCSVLines(tt.path, 0, 0)
 			if tt.expectErr {
 				require.Error(t, err)
 				return
@@ -107,15 +124,19 @@ func TestValidateCSVFile(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "with insecure filenames",
+			lines: [][]string{
+				{filenameColName, passwordColName},
+				{"../file_1.zip", "password_1"},
+			},
+			expectErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateCSVFile(tt.lines)
-			if tt.expectErr {
-				require.Error(t, err)
-				return
-			}
-			require.NoError(t, err)
+			errs := validateCSVContent(t, tt.lines)
+			require.Equal(t, tt.expectErr, len(errs) > 0, "errs: %v", errs)
 		})
 	}
 }
@@ -157,27 +178,23 @@ func TestValidateLineCount(t *testing.T) {
 func TestValidateHeaderColCount(t *testing.T) {
 	tests := []struct {
 		name      string
-		lines     [][]string
+		header    []string
 		expectErr bool
 	}{
 		{
-			name: "with a valid header col count",
-			lines: [][]string{
-				{filenameColName, passwordColName},
-			},
+			name:      "with a valid header col count",
+			header:    []string{filenameColName, passwordColName},
 			expectErr: false,
 		},
 		{
-			name: "with an invalid header col count",
-			lines: [][]string{
-				{filenameColName},
-			},
+			name:      "with an invalid header col count",
+			header:    []string{filenameColName},
 			expectErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateHeaderColCount(tt.lines)
+			err := validateHeaderColCount(tt.header)
 			if tt.expectErr {
 				require.Error(t, err)
 				return
@@ -187,7 +204,7 @@ func TestValidateHeaderColCount(t *testing.T) {
 	}
 }
 
-func TestCheckEmptyFilenames(t *testing.T) {
+func TestValidateEmptyFilenames(t *testing.T) {
 	tests := []struct {
 		name                  string
 		lines                 [][]string
@@ -200,7 +217,7 @@ func TestCheckEmptyFilenames(t *testing.T) {
 				{"file_1.zip", "password_1"},
 				{"file_2.zip", "password_2"},
 			},
-			emptyFilenameLineNums: []int{},
+			emptyFilenameLineNums: nil,
 		},
 		{
 			name: "with empty filenames",
@@ -215,19 +232,21 @@ func TestCheckEmptyFilenames(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := checkEmptyFilenames(tt.lines)
+			validator := validateLines(tt.lines, false)
+			require.Equal(t, tt.emptyFilenameLineNums, validator.emptyLineNums)
+			errs := validator.errs()
 			if len(tt.emptyFilenameLineNums) > 0 {
-				require.Error(t, err)
-				errMsgContainsEmptyFilenameLineNums := strings.Contains(err.Error(), joinLineNums(tt.emptyFilenameLineNums))
+				require.Len(t, errs, 1)
+				errMsgContainsEmptyFilenameLineNums := strings.Contains(errs[0].Error(), joinLineNums(tt.emptyFilenameLineNums))
 				require.True(t, errMsgContainsEmptyFilenameLineNums)
 				return
 			}
-			require.NoError(t, err)
+			require.Empty(t, errs)
 		})
 	}
 }
 
-func TestCheckDuplicateFilenames(t *testing.T) {
+func TestValidateDuplicateFilenames(t *testing.T) {
 	tests := []struct {
 		name              string
 		lines             [][]string
@@ -240,7 +259,7 @@ func TestCheckDuplicateFilenames(t *testing.T) {
 				{"file_1.zip", "password_1"},
 				{"file_2.zip", "password_2"},
 			},
-			duplicateLineNums: []int{},
+			duplicateLineNums: nil,
 		},
 		{
 			name: "with duplicate filenames",
@@ -255,112 +274,201 @@ func TestCheckDuplicateFilenames(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := checkDuplicateFilenames(tt.lines)
+			validator := validateLines(tt.lines, false)
+			require.Equal(t, tt.duplicateLineNums, validator.duplicateLineNums)
+			errs := validator.errs()
 			if len(tt.duplicateLineNums) > 0 {
-				require.Error(t, err)
-				errMsgContainsDuplicateLineNums := strings.Contains(err.Error(), joinLineNums(tt.duplicateLineNums))
+				require.Len(t, errs, 1)
+				errMsgContainsDuplicateLineNums := strings.Contains(errs[0].Error(), joinLineNums(tt.duplicateLineNums))
 				require.True(t, errMsgContainsDuplicateLineNums)
 				return
 			}
-			require.NoError(t, err)
+			require.Empty(t, errs)
 		})
 	}
 }
 
-func TestParseZipFiles(t *testing.T) {
-	dirPath := os.TempDir()
-	filename1 := "file_1.zip"
-	filePath1 := filepath.Join(dirPath, filename1)
-	password1 := "password_1"
-	filename2 := "file_2.zip"
-	filePath2 := filepath.Join(dirPath, filename2)
-	password2 := "password_2"
+func TestValidateInsecureFilenames(t *testing.T) {
 	lines := [][]string{
 		{filenameColName, passwordColName},
-		{filename1, password1},
-		{filename2, password2},
+		{"file_1.zip", "password_1"},
+		{"../file_2.zip", "password_2"},
+		{"/tmp/file_3.zip", "password_3"},
+		{`dir\file_4.zip`, "password_4"},
+		{"dir/file_5.zip", "password_5"},
+		{"dir/../../file_6.zip", "password_6"},
 	}
-	expected := []zipFile{
+	tests := []struct {
+		name             string
+		allowSubdirs     bool
+		insecureLineNums []int
+	}{
 		{
-			path:     filePath1,
-			password: password1,
+			name:             "without subdirs",
+			allowSubdirs:     false,
+			insecureLineNums: []int{3, 4, 5, 6, 7},
 		},
 		{
-			path:     filePath2,
-			password: password2,
+			name:             "with subdirs",
+			allowSubdirs:     true,
+			insecureLineNums: []int{3, 4, 5, 7},
 		},
 	}
-	actual := parseZipFiles(dirPath, lines)
-	require.Equal(t, expected, actual)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := validateLines(lines, tt.allowSubdirs)
+			require.Equal(t, tt.insecureLineNums, validator.insecureLineNums)
+			errs := validator.errs()
+			require.Len(t, errs, 1)
+			require.Contains(t, errs[0].Error(), joinLineNums(tt.insecureLineNums))
+		})
+	}
+}
+
+func TestReadZipFiles(t *testing.T) {
+	dirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirPath)
+
+	for _, name := range []string{"file_1.zip", "file_2.zip"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dirPath, name), nil, 0644))
+	}
+	content := "File Name,Zip Password\nfile_1.zip,password_1\n,password_2\nfile_1.zip,password_3\nfile_2.zip,password_4\nfile_3.zip,password_5\n"
+	csvFilePath, err := createTempFile("", "test*.csv", []byte(content))
+	require.NoError(t, err)
+	defer os.Remove(csvFilePath)
+
+	reader, err := openCSVFile(csvFilePath, 0, 0)
+	require.NoError(t, err)
+	defer reader.close()
+	_, err = reader.read()
+	require.NoError(t, err)
+
+	var scheduled []zipFile
+	files, errs := readZipFiles(reader, dirPath, csvCols{filename: 0, password: 1}, false, func(file zipFile) {
+		scheduled = append(scheduled, file)
+	})
+	expected := []zipFile{
+		{path: filepath.Join(dirPath, "file_1.zip"), password: "password_1"},
+		{path: filepath.Join(dirPath, "file_2.zip"), password: "password_4"},
+		{path: filepath.Join(dirPath, "file_3.zip"), password: "password_5"},
+	}
+	require.Equal(t, expected, files)
+	require.Equal(t, expected, scheduled)
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0].Error(), "empty filename found on line(s) 3")
+	require.Contains(t, errs[1].Error(), "duplicate filenames found on lines 2, 4")
 }
 
-func TestValidateZipFiles(t *testing.T) {
+func TestValidateZipFile(t *testing.T) {
 	filePath, err := createTempFile("", "file_1.zip", nil)
 	require.NoError(t, err)
 	defer os.Remove(filePath)
 
 	tests := []struct {
 		name      string
-		files     []zipFile
+		file      zipFile
 		expectErr bool
 	}{
 		{
-			name: "with valid files",
-			files: []zipFile{
-				{
-					path: filePath,
-				},
-			},
+			name:      "with a valid file",
+			file:      zipFile{path: filePath},
 			expectErr: false,
 		},
 		{
-			name: "with a non-existing file",
-			files: []zipFile{
-				{
-					path: "non-existing_file.zip",
-				},
-			},
+			name:      "with a non-existing file",
+			file:      zipFile{path: "non-existing_file.zip"},
 			expectErr: true,
 		},
 		{
-			name: "with an irregular file (dir)",
-			files: []zipFile{
-				{
-					path: os.TempDir(),
-				},
-			},
+			name:      "with an irregular file (dir)",
+			file:      zipFile{path: os.TempDir()},
 			expectErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateZipFiles(tt.files)
+			err := validateZipFile(tt.file)
 			errExists := err != nil
 			require.Equal(t, tt.expectErr, errExists)
 		})
 	}
 }
 
+func TestUnzipDirWithCaseMismatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires a case-sensitive file system")
+	}
+	dirPath := t.TempDir()
+	zipFilePath := createTestZipFile(t, []testZipEntry{{name: "readme.txt", content: "readme"}}, "password_1")
+	data, err := os.ReadFile(zipFilePath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dirPath, "file_1.zip"), data, 0644))
+	csvFilePath := filepath.Join(t.TempDir(), "files.csv")
+	require.NoError(t, os.WriteFile(csvFilePath, []byte("File Name,Zip Password\nFILE_1.zip,password_1\n"), 0644))
+
+	var log bytes.Buffer
+	opts := csvOptions{
+		unlistedMode:    unlistedModeExtract,
+		defaultPassword: "password_2",
+	}
+	err = unzipDir(context.Background(), dirPath, csvFilePath, opts, unzipOptions{logWriter: &log})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "FILE_1.zip")
+	require.Contains(t, log.String(), "found as '"+filepath.Join(dirPath, "file_1.zip")+"' in the dir")
+	require.NoDirExists(t, filepath.Join(dirPath, "file_1"))
+}
+
 func TestFindFilenameColIndex(t *testing.T) {
 	tests := []struct {
-		name     string
-		header   []string
-		expected int
+		name      string
+		header    []string
+		col       string
+		expected  int
+		expectErr bool
 	}{
 		{
 			name:     "with the filename column",
 			header:   []string{"column 1", filenameColName, "column 2"},
 			expected: 1,
 		},
+		{
+			name:     "with a differently cased and padded filename column",
+			header:   []string{"column 1", " file name ", "column 2"},
+			expected: 1,
+		},
 		{
 			name:     "without the filename column",
 			header:   []string{"column 1", "column 2"},
 			expected: 0,
 		},
+		{
+			name:     "with a column name override",
+			header:   []string{"column 1", "column 2"},
+			col:      "Column 2",
+			expected: 1,
+		},
+		{
+			name:     "with a column number override",
+			header:   []string{"column 1", "column 2"},
+			col:      "2",
+			expected: 1,
+		},
+		{
+			name:      "with a non-existing column override",
+			header:    []string{"column 1", "column 2"},
+			col:       "column 3",
+			expectErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := findFilenameColIndex(tt.header)
+			actual, err := findFilenameColIndex(tt.header, tt.col)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
 			require.Equal(t, tt.expected, actual)
 		})
 	}
@@ -368,24 +476,48 @@ func TestFindFilenameColIndex(t *testing.T) {
 
 func TestFindPasswordColIndex(t *testing.T) {
 	tests := []struct {
-		name     string
-		header   []string
-		expected int
+		name      string
+		header    []string
+		col       string
+		expected  int
+		expectErr bool
 	}{
 		{
 			name:     "with the password column",
 			header:   []string{"column 1", passwordColName, "column 2"},
 			expected: 1,
 		},
+		{
+			name:     "with a differently cased and padded password column",
+			header:   []string{"column 1", "ZIP PASSWORD  ", "column 2"},
+			expected: 1,
+		},
 		{
 			name:     "without the password column",
 			header:   []string{"column 1", "column 2"},
 			expected: 1,
 		},
+		{
+			name:     "with a column number override",
+			header:   []string{"column 1", "column 2", "column 3"},
+			col:      "1",
+			expected: 0,
+		},
+		{
+			name:      "with an out of range column number override",
+			header:    []string{"column 1", "column 2"},
+			col:       "3",
+			expectErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := findPasswordColIndex(tt.header)
+			actual, err := findPasswordColIndex(tt.header, tt.col)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
 			require.Equal(t, tt.expected, actual)
 		})
 	}
@@ -398,32 +530,6 @@ func TestJoinLineNums(t *testing.T) {
 	require.Equal(t, expected, actual)
 }
 
-func TestLineNumExists(t *testing.T) {
-	lineNums := []int{1, 2}
-	tests := []struct {
-		name     string
-		lineNum  int
-		expected bool
-	}{
-		{
-			name:     "with an existing line number",
-			lineNum:  1,
-			expected: true,
-		},
-		{
-			name:     "with a non-existing line number",
-			lineNum:  3,
-			expected: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			actual := lineNumExists(tt.lineNum, lineNums)
-			require.Equal(t, tt.expected, actual)
-		})
-	}
-}
-
 func createTempFile(dir string, filename string, content []byte) (string, error) {
 	file, err := os.CreateTemp(dir, filename)
 	if err != nil {
@@ -435,3 +541,113 @@ func createTempFile(dir string, filename string, content []byte) (string, error)
 	}
 	return file.Name(), nil
 }
+
+// validateCSVContent writes the lines to a csv file and validates it the way
+// unzipDir does while reading it.
+func validateCSVContent(t *testing.T, lines [][]string) []error {
+	t.Helper()
+	csvFilePath := filepath.Join(t.TempDir(), "files.csv")
+	file, err := os.Create(csvFilePath)
+	require.NoError(t, err)
+	require.NoError(t, csv.NewWriter(file).WriteAll(lines))
+	require.NoError(t, file.Close())
+
+	reader, err := openCSVFile(csvFilePath, 0, 0)
+	require.NoError(t, err)
+	defer reader.close()
+	header, err := reader.read()
+	require.NoError(t, err)
+	cols, err := validateCSVHeader(header, csvOptions{})
+	if err != nil {
+		return []error{err}
+	}
+	_, errs := readZipFiles(reader, t.TempDir(), cols, false, func(zipFile) {})
+	return errs
+}
+
+func validateLines(lines [][]string, allowSubdirs bool) *csvRowValidator {
+	validator := newCSVRowValidator(csvCols{filename: 0, password: 1}, allowSubdirs)
+	for i := 1; i < len(lines); i++ {
+		validator.validate(i+1, lines[i])
+	}
+	return validator
+}
+
+func BenchmarkReadCSVRows(b *testing.B) {
+	for _, rowCount := range []int{1000, 10000, 100000} {
+		b.Run(strconv.Itoa(rowCount), func(b *testing.B) {
+			csvFilePath, err := createTempFile("", "bench*.csv", makeCSVContent(rowCount))
+			require.NoError(b, err)
+			defer os.Remove(csvFilePath)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				reader, err := openCSVFile(csvFilePath, 0, 0)
+				require.NoError(b, err)
+				for {
+					_, err := reader.read()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(b, err)
+				}
+				reader.close()
+			}
+			reportNsPerRow(b, rowCount)
+		})
+	}
+}
+
+func BenchmarkValidateCSVRows(b *testing.B) {
+	for _, rowCount := range []int{1000, 10000, 100000} {
+		b.Run(strconv.Itoa(rowCount), func(b *testing.B) {
+			lines, err := csv.NewReader(bytes.NewReader(makeCSVContent(rowCount))).ReadAll()
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				validator := validateLines(lines, false)
+				require.Empty(b, validator.errs())
+			}
+			reportNsPerRow(b, rowCount)
+		})
+	}
+}
+
+func BenchmarkReadZipFiles(b *testing.B) {
+	for _, rowCount := range []int{1000, 10000, 100000} {
+		b.Run(strconv.Itoa(rowCount), func(b *testing.B) {
+			csvFilePath, err := createTempFile("", "bench*.csv", makeCSVContent(rowCount))
+			require.NoError(b, err)
+			defer os.Remove(csvFilePath)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				reader, err := openCSVFile(csvFilePath, 0, 0)
+				require.NoError(b, err)
+				header, err := reader.read()
+				require.NoError(b, err)
+				cols, err := validateCSVHeader(header, csvOptions{})
+				require.NoError(b, err)
+				files, errs := readZipFiles(reader, os.TempDir(), cols, false, func(zipFile) {})
+				require.Empty(b, errs)
+				require.Len(b, files, rowCount)
+				reader.close()
+			}
+			reportNsPerRow(b, rowCount)
+		})
+	}
+}
+
+func makeCSVContent(rowCount int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("File Name,Zip Password\n")
+	for i := 0; i < rowCount; i++ {
+		fmt.Fprintf(&buf, "file_%d.zip,password_%d\n", i, i)
+	}
+	return buf.Bytes()
+}
+
+func reportNsPerRow(b *testing.B, rowCount int) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*rowCount), "ns/row")
+}
@@ -3,108 +3,366 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
-	"github.com/alexmullins/zip"
+	"github.com/binalyze/biunzip/internal/zip"
+	"golang.org/x/text/encoding"
 )
 
 const defaultBufSize = 10 * 1024 * 1024 // 10MB
 
-func unzipFile(ctx context.Context, filePath string, password string) error {
-	dirPath := makeDirPath(filePath)
+type unzipOptions struct {
+	filter          entryFilter
+	recursiveDepth  int
+	nameEncoding    encoding.Encoding
+	windowsPaths    string
+	insecureEntries string
+	portableNames   bool
+	symlinks        string
+	modes           modePolicy
+	seal            bool
+	xattrs          bool
+	progress        bool
+	recover         bool
+	logWriter       io.Writer
+}
+
+// entryFunc is called with the zip entries to unzip and their names as stored
+// in the zip file, before they are decoded or rewritten.
+type entryFunc func(zipEntry *zip.File, rawName string) error
+
+// zipSource is a zip file to unzip. The name is logged, reported and tagged
+// instead of the path, e.g. stdin for a stream spooled to a temp file. A
+// nested archive is read from the handle opened through its root instead.
+type zipSource struct {
+	name   string
+	path   string
+	reader io.ReaderAt
+	size   int64
+}
+
+func newZipSource(filePath string) zipSource {
+	return zipSource{name: filePath, path: filePath}
+}
+
+func (s zipSource) open(recoverEntries bool) (*zipArchive, error) {
+	if s.reader != nil {
+		return openZipVolumes(newReaderVolumes(s.reader, s.size), s.name, recoverEntries)
+	}
+	return openZipFile(s.path, recoverEntries)
+}
+
+func unzipFile(ctx context.Context, filePath string, password string, opts unzipOptions) error {
+	return unzipFileToDir(ctx, newZipSource(filePath), makeDirPath(filePath), password, opts)
+}
+
+func unzipFileToDir(ctx context.Context, source zipSource, dirPath string, password string, opts unzipOptions) error {
+	return unzipToDir(dirPath, opts, func(root *os.Root) (unzipReport, error) {
+		return unzipFileToRoot(ctx, source, root, password, opts)
+	})
+}
+
+// unzipToDir unzips to the dir with fn, and prints the report of the zip file
+// once the dir is sealed.
+func unzipToDir(dirPath string, opts unzipOptions, fn func(root *os.Root) (unzipReport, error)) error {
 	err := os.MkdirAll(dirPath, 0755) // 0755: rwxr-xr-x
 	if err != nil {
 		return fmt.Errorf("failed to create dir '%s': %w", dirPath, err)
 	}
+	// all writes go through the root, so symlinks in the dir can't redirect
+	// them outside of it.
+	root, err := os.OpenRoot(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dir '%s': %w", dirPath, err)
+	}
+	defer root.Close()
 
-	zipReader, err := zip.OpenReader(filePath)
+	report, err := fn(root)
+	defer func() {
+		opts.logReport(report)
+	}()
+	modesErr := opts.modes.applyDirModes(root)
+	if modesErr != nil {
+		if err != nil {
+			return joinMultiErrs([]error{err, modesErr})
+		}
+		return modesErr
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open file '%s': %w", filePath, err)
+		return err
 	}
-	defer zipReader.Close()
+	if opts.seal {
+		report.sealedAt, err = sealDir(root)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if name, hasInsecure := hasInsecurePaths(zipReader.File); hasInsecure {
-		return fmt.Errorf("insecure path '%s' found in zip file '%s'", name, filePath)
+func unzipFileToRoot(ctx context.Context, source zipSource, root *os.Root, password string, opts unzipOptions) (unzipReport, error) {
+	xattrs, err := newXattrSource(ctx, source, opts)
+	if err != nil {
+		return unzipReport{}, err
 	}
 
-	fmt.Printf("unzipping %s...\n", filePath)
-	var errs []error
-	for _, zipEntry := range zipReader.File {
-		err = ctx.Err()
+	var nestedNames []string
+	report, err := walkZipFile(ctx, source, opts, func(zipEntry *zip.File, rawName string) error {
+		if opts.symlinks == symlinksCreate && isSymlink(zipEntry) {
+			return createSymlink(zipEntry, root, password, opts.modes)
+		}
+		err := extractEntry(ctx, zipEntry, rawName, root, password, opts, xattrs)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("context error: %w", err))
-			break
+			return err
 		}
+		if opts.recursiveDepth > 0 && !zipEntry.FileInfo().IsDir() {
+			nestedNames = append(nestedNames, filepath.FromSlash(zipEntry.Name))
+		}
+		return nil
+	})
 
-		dstPath := filepath.Join(dirPath, zipEntry.Name)
-
-		if zipEntry.FileInfo().IsDir() {
-			_ = os.MkdirAll(dstPath, zipEntry.Mode())
-			continue
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(report.sanitizedNames) > 0 {
+		err = writeInsecureMapping(root, report.sanitizedNames)
+		if err != nil {
+			errs = append(errs, err)
 		}
+	}
+	filtered, nestedErrs := unzipNestedArchives(ctx, root, nestedNames, password, opts)
+	report.filtered += filtered
+	errs = append(errs, nestedErrs...)
+	if len(errs) > 0 {
+		return report, joinMultiErrs(errs)
+	}
+	return report, nil
+}
 
-		dstDirPath := filepath.Dir(dstPath)
-		_ = os.MkdirAll(dstDirPath, zipEntry.Mode())
+func walkZipFile(ctx context.Context, source zipSource, opts unzipOptions, fn entryFunc) (unzipReport, error) {
+	zipReader, err := source.open(opts.recover)
+	if err != nil {
+		return unzipReport{}, err
+	}
+	defer zipReader.Close()
 
-		zipEntry.DeferAuth = true
+	report := unzipReport{filePath: source.name, unrecoverable: zipReader.unrecoverable}
+	if zipReader.recoverErr != nil {
+		opts.logf("failed to read the central directory of %s, rebuilt the entry list from the local headers: %v\n", source.name, zipReader.recoverErr)
+	}
+	rawNames := make(map[*zip.File]string, len(zipReader.File))
+	for _, zipEntry := range zipReader.File {
+		rawNames[zipEntry] = zipEntry.Name
+	}
+	report.decodedNames, err = decodeEntryNames(zipReader.File, opts.nameEncoding)
+	if err != nil {
+		return unzipReport{}, fmt.Errorf("failed to read zip file '%s': %w", source.name, err)
+	}
+	if opts.windowsPaths == windowsPathsNormalize {
+		normalizeWindowsPaths(zipReader.File)
+	}
 
-		if len(password) > 0 {
-			zipEntry.SetPassword(password)
+	files := zipReader.File
+	switch opts.insecureEntries {
+	case insecureEntriesSkip:
+		files, report.skippedNames = skipInsecurePaths(files)
+	case insecureEntriesSanitize:
+		report.sanitizedNames = sanitizeInsecurePaths(files)
+	default:
+		if name, hasInsecure := hasInsecurePaths(files); hasInsecure {
+			return unzipReport{}, fmt.Errorf("insecure path '%s' found in zip file '%s'", name, source.name)
 		}
+	}
+	if opts.portableNames {
+		report.portableNames = makePortableNames(files)
+	}
+	if opts.symlinks == symlinksCreate {
+		files = moveSymlinksLast(files)
+	}
 
-		zipEntryReader, err := zipEntry.Open()
+	opts.logf("unzipping %s...\n", source.name)
+	var errs []error
+	for _, entry := range report.unrecoverable {
+		errs = append(errs, fmt.Errorf("failed to recover zip entry '%s' at offset %d: %s", entry.name, entry.offset, entry.reason))
+	}
+	for _, zipEntry := range files {
+		err = ctx.Err()
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to open zip entry '%s': %w", zipEntry.Name, err))
-			continue
+			errs = append(errs, fmt.Errorf("context error: %w", err))
+			break
 		}
-		ctxZipEntryReader := newContextReader(ctx, zipEntryReader)
-		srcReader := bufio.NewReaderSize(ctxZipEntryReader, defaultBufSize)
 
-		dstFile, err := os.OpenFile(dstPath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, zipEntry.Mode())
-		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to create dst file '%s': %w", dstPath, err))
+		if opts.symlinks == symlinksSkip && isSymlink(zipEntry) {
+			report.skippedSymlinks++
 			continue
 		}
-		dstWriter := bufio.NewWriterSize(dstFile, defaultBufSize)
 
-		_, err = io.Copy(dstWriter, srcReader)
-		if err == nil {
-			err = dstWriter.Flush()
-		}
-		if err != nil {
-			_ = dstFile.Close()
-			errs = append(errs, fmt.Errorf("failed to copy src file '%s' to dst file '%s': %w", zipEntry.Name, dstPath, err))
+		if !opts.filter.match(zipEntry) {
+			report.filtered++
 			continue
 		}
 
-		err = dstFile.Close()
+		err = fn(zipEntry, rawNames[zipEntry])
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to close destination file '%s': %w", dstPath, err))
+			report.failed++
+			errs = append(errs, err)
 			continue
 		}
-
-		_ = zipEntryReader.Close()
+		report.extracted++
 	}
 	if len(errs) > 0 {
-		msg := fmt.Sprintf("failed to unzip file '%s'", filePath)
-		return makeMultiErr(msg, errs)
+		msg := fmt.Sprintf("failed to unzip file '%s'", source.name)
+		return report, makeMultiErr(msg, errs)
 	}
-	return nil
+	return report, nil
+}
+
+type zipArchive struct {
+	*zip.Reader
+	volumes       *volumeReader
+	recoverErr    error
+	unrecoverable []unrecoverableEntry
+}
+
+// openZipFile opens a zip file or the volumes of a split zip file. With
+// recoverEntries, the entry list of a zip file whose central directory can't
+// be read is rebuilt from the local headers.
+func openZipFile(filePath string, recoverEntries bool) (*zipArchive, error) {
+	volumes, err := openVolumes(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file '%s': %w", filePath, err)
+	}
+	return openZipVolumes(volumes, filePath, recoverEntries)
+}
+
+// openZipVolumes opens the zip file presented by the volumes, and closes them
+// if it fails.
+func openZipVolumes(volumes *volumeReader, filePath string, recoverEntries bool) (*zipArchive, error) {
+	archive := &zipArchive{volumes: volumes}
+	var err error
+	archive.Reader, err = zip.NewReader(volumes, volumes.size)
+	if err == nil {
+		err = volumes.fixEntryOffsets(archive.File)
+	}
+	if err != nil && recoverEntries && !volumes.spanned {
+		archive.recoverErr = err
+		archive.Reader, archive.unrecoverable, err = recoverZipFile(volumes, volumes.size)
+	}
+	if err != nil {
+		_ = volumes.Close()
+		if len(volumes.readers) > 1 {
+			return nil, fmt.Errorf("failed to open split zip file '%s' with %d volumes: %w", filePath, len(volumes.readers), err)
+		}
+		return nil, fmt.Errorf("failed to open file '%s': %w", filePath, err)
+	}
+	return archive, nil
+}
+func (a *zipArchive) Close() error {
+	return a.volumes.Close()
+}
+
+func (opts unzipOptions) logf(format string, args ...any) {
+	logWriter := opts.logWriter
+	if logWriter == nil {
+		logWriter = os.Stdout
+	}
+	fmt.Fprintf(logWriter, format, args...)
+}
+
+func extractEntry(ctx context.Context, zipEntry *zip.File, rawName string, root *os.Root, password string, opts unzipOptions, source *xattrSource) error {
+	if zipEntry.FileInfo().IsDir() {
+		return createEntryDir(zipEntry, root, opts.modes)
+	}
+
+	zipEntryReader, err := openZipEntry(zipEntry, password)
+	if err != nil {
+		return err
+	}
+	defer zipEntryReader.Close()
+	return writeEntryFile(ctx, zipEntry, rawName, zipEntryReader, root, opts, source)
+}
+
+func createEntryDir(zipEntry *zip.File, root *os.Root, modes modePolicy) error {
+	name := filepath.FromSlash(zipEntry.Name)
+	_ = root.MkdirAll(name, modes.entryDirMode(zipEntry))
+	return modes.applyEntryMode(root, name, zipEntry)
+}
+
+func writeEntryFile(ctx context.Context, zipEntry *zip.File, rawName string, zipEntryReader io.Reader, root *os.Root, opts unzipOptions, source *xattrSource) error {
+	modes := opts.modes
+	name := filepath.FromSlash(zipEntry.Name)
+	dstPath := filepath.Join(root.Name(), name)
+
+	_ = root.MkdirAll(filepath.Dir(name), modes.entryDirMode(nil))
+
+	ctxZipEntryReader := newProgressReader(newContextReader(ctx, zipEntryReader), zipEntry, opts)
+	srcReader := bufio.NewReaderSize(ctxZipEntryReader, defaultBufSize)
+
+	dstFile, err := root.OpenFile(name, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, modes.entryFileMode(zipEntry))
+	if err != nil {
+		return fmt.Errorf("failed to create dst file '%s': %w", dstPath, err)
+	}
+	dstWriter := bufio.NewWriterSize(dstFile, defaultBufSize)
+
+	_, err = io.Copy(dstWriter, srcReader)
+	if err == nil {
+		err = dstWriter.Flush()
+	}
+	if err != nil {
+		_ = dstFile.Close()
+		return fmt.Errorf("failed to copy src file '%s' to dst file '%s': %w", zipEntry.Name, dstPath, err)
+	}
+
+	err = source.tag(dstFile, zipEntry, rawName)
+	if err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close destination file '%s': %w", dstPath, err)
+	}
+	return modes.applyEntryMode(root, name, zipEntry)
+}
+
+func openZipEntry(zipEntry *zip.File, password string) (io.ReadCloser, error) {
+	zipEntry.DeferAuth = true
+
+	if len(password) > 0 && zipEntry.IsEncrypted() {
+		zipEntry.SetPassword(password)
+	}
+
+	zipEntryReader, err := zipEntry.Open()
+	if errors.Is(err, zip.ErrAlgorithm) {
+		return nil, makeUnsupportedMethodErr(zipEntry)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip entry '%s': %w", zipEntry.Name, err)
+	}
+	return zipEntryReader, nil
 }
 
 func makeDirPath(filePath string) string {
+	if match := splitSegmentPattern.FindStringSubmatch(filePath); match != nil {
+		filePath = filePath[:len(filePath)-len(match[1])-1]
+	}
 	ext := filepath.Ext(filePath)
+	if len(ext) == 0 {
+		return filePath + "_unzipped"
+	}
 	dirPath := filePath[:len(filePath)-len(ext)]
 	return dirPath
 }
 
 func hasInsecurePaths(files []*zip.File) (string, bool) {
 	for _, file := range files {
-		if !filepath.IsLocal(file.Name) || strings.Contains(file.Name, `\`) {
+		if isInsecurePath(file.Name) {
 			return file.Name, true
 		}
 	}
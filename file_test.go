@@ -1,14 +1,202 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/binalyze/biunzip/internal/zip"
 	"github.com/stretchr/testify/require"
 )
 
+type testZipEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+func TestUnzipFile(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "logs/security.evtx", content: "security"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	tests := []struct {
+		name      string
+		password  string
+		opts      unzipOptions
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name: "without a password",
+			expected: map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+				"files/readme.txt":   "readme",
+			},
+		},
+		{
+			name:     "with a password",
+			password: "password_1",
+			expected: map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+				"files/readme.txt":   "readme",
+			},
+		},
+		{
+			name:     "with filters",
+			password: "password_1",
+			opts: unzipOptions{
+				filter: entryFilter{
+					includes: []string{"*.evtx"},
+					excludes: []string{"security.*"},
+				},
+			},
+			expected: map[string]string{
+				"logs/system.evtx": "system",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, tt.password)
+			err := unzipFile(context.Background(), filePath, tt.password, tt.opts)
+			require.NoError(t, err)
+			requireDirContent(t, makeDirPath(filePath), tt.expected)
+		})
+	}
+}
+
+func TestUnzipFileWithWrongPassword(t *testing.T) {
+	filePath := createTestZipFile(t, []testZipEntry{{name: "file_1.txt", content: "test"}}, "password_1")
+	err := unzipFile(context.Background(), filePath, "password_2", unzipOptions{})
+	require.Error(t, err)
+}
+
+func TestUnzipFileWithPlantedSymlinks(t *testing.T) {
+	skipWithoutSymlinks(t)
+	innerZipFilePath := createTestZipFile(t, []testZipEntry{{name: "inner.txt", content: "inner"}}, "")
+	innerZipContent, err := os.ReadFile(innerZipFilePath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		entry    testZipEntry
+		linkName string
+		linkFile bool
+	}{
+		{
+			name:     "with a dir symlink",
+			entry:    testZipEntry{name: "logs/system.evtx", content: "system"},
+			linkName: "logs",
+		},
+		{
+			name:     "with a parent dir symlink",
+			entry:    testZipEntry{name: "logs/windows/system.evtx", content: "system"},
+			linkName: "logs",
+		},
+		{
+			name:     "with a file symlink",
+			entry:    testZipEntry{name: "system.evtx", content: "system"},
+			linkName: "system.evtx",
+			linkFile: true,
+		},
+		{
+			name:     "with a nested archive dir symlink",
+			entry:    testZipEntry{name: "inner.zip", content: string(innerZipContent)},
+			linkName: "inner",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, []testZipEntry{tt.entry}, "")
+			outsideDirPath := t.TempDir()
+			outsideFilePath := filepath.Join(outsideDirPath, "outside.txt")
+			require.NoError(t, os.WriteFile(outsideFilePath, []byte("outside"), 0644))
+
+			dirPath := makeDirPath(filePath)
+			require.NoError(t, os.MkdirAll(dirPath, 0755))
+			target := outsideDirPath
+			if tt.linkFile {
+				target = outsideFilePath
+			}
+			require.NoError(t, os.Symlink(target, filepath.Join(dirPath, tt.linkName)))
+
+			opts := unzipOptions{
+				recursiveDepth: 1,
+			}
+			err := unzipFile(context.Background(), filePath, "", opts)
+			require.Error(t, err)
+			requireDirContent(t, outsideDirPath, map[string]string{"outside.txt": "outside"})
+		})
+	}
+}
+
 func TestMakeDirPath(t *testing.T) {
 	filePath := "/tmp/file_1.zip"
 	expected := "/tmp/file_1"
 	actual := makeDirPath(filePath)
 	require.Equal(t, expected, actual)
+
+	require.Equal(t, "/tmp/file_1_unzipped", makeDirPath("/tmp/file_1"))
+	require.Equal(t, "/tmp/file_1", makeDirPath("/tmp/file_1.zip.003"))
+}
+
+func createTestZipFile(t *testing.T, entries []testZipEntry, password string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:   entry.name,
+			Method: zip.Deflate,
+		}
+		header.SetMode(0644)
+		if strings.HasSuffix(entry.name, "/") {
+			header.SetMode(os.ModeDir | 0755)
+		}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		if len(password) > 0 && len(entry.content) > 0 {
+			header.SetPassword(password)
+		}
+		entryWriter, err := writer.CreateHeader(header)
+		require.NoError(t, err)
+		_, err = entryWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return filePath
+}
+
+func requireDirContent(t *testing.T, dirPath string, expected map[string]string) {
+	t.Helper()
+	actual := make(map[string]string)
+	err := filepath.WalkDir(dirPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		actual[filepath.ToSlash(name)] = string(content)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
 }
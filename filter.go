@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const dateLayout = "2006-01-02"
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+type entryFilter struct {
+	includes       []string
+	excludes       []string
+	minSize        int64
+	maxSize        int64
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+}
+
+func newEntryFilter(includes []string, excludes []string, minSize string, maxSize string, modifiedAfter string, modifiedBefore string) (entryFilter, error) {
+	filter := entryFilter{
+		includes: includes,
+		excludes: excludes,
+	}
+	for _, pattern := range append(includes, excludes...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return entryFilter{}, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	var err error
+	filter.minSize, err = parseSize(minSize)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	filter.maxSize, err = parseSize(maxSize)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	filter.modifiedAfter, err = parseTime(modifiedAfter)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	filter.modifiedBefore, err = parseTime(modifiedBefore)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	return filter, nil
+}
+
+func (f entryFilter) match(entry *zip.File) bool {
+	if len(f.includes) > 0 && !matchAnyPattern(f.includes, entry.Name) {
+		return false
+	}
+	if matchAnyPattern(f.excludes, entry.Name) {
+		return false
+	}
+	if entry.FileInfo().IsDir() {
+		return true
+	}
+	size := int64(entry.UncompressedSize64)
+	if f.minSize > 0 && size < f.minSize {
+		return false
+	}
+	if f.maxSize > 0 && size > f.maxSize {
+		return false
+	}
+	modTime := entry.ModTime()
+	if !f.modifiedAfter.IsZero() && !modTime.After(f.modifiedAfter) {
+		return false
+	}
+	if !f.modifiedBefore.IsZero() && !modTime.Before(f.modifiedBefore) {
+		return false
+	}
+	return true
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches the entry name and all of its parent dirs, so a
+// pattern matching a dir also matches everything in it. Patterns without a
+// slash are also matched against the base name.
+func matchPattern(pattern string, name string) bool {
+	name = strings.TrimSuffix(name, "/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(name))
+		if matched {
+			return true
+		}
+	}
+	for len(name) > 0 && name != "." {
+		matched, _ := path.Match(pattern, name)
+		if matched {
+			return true
+		}
+		name = path.Dir(name)
+	}
+	return false
+}
+
+func parseSize(value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	upperValue := strings.ToUpper(strings.TrimSpace(value))
+	unitSize := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(upperValue, unit.suffix) {
+			upperValue = strings.TrimSpace(strings.TrimSuffix(upperValue, unit.suffix))
+			unitSize = unit.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(upperValue, 10, 64)
+	if err != nil || size < 0 || size > math.MaxInt64/unitSize {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return size * unitSize, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(dateLayout, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'. use the YYYY-MM-DD or RFC 3339 format", value)
+}
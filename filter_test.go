@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEntryFilter(t *testing.T) {
+	_, err := newEntryFilter([]string{"*.evtx"}, []string{"Temp"}, "1KB", "1GB", "2024-01-01", "2024-12-31T00:00:00Z")
+	require.NoError(t, err)
+
+	_, err = newEntryFilter([]string{"[.evtx"}, nil, "", "", "", "")
+	require.Error(t, err)
+
+	_, err = newEntryFilter(nil, nil, "big", "", "", "")
+	require.Error(t, err)
+
+	_, err = newEntryFilter(nil, nil, "", "", "yesterday", "")
+	require.Error(t, err)
+}
+
+func TestEntryFilterMatch(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	entry := &zip.File{
+		FileHeader: zip.FileHeader{
+			Name:               "Windows/System32/winevt/Logs/Security.evtx",
+			UncompressedSize64: 2048,
+		},
+	}
+	entry.SetModTime(modTime)
+
+	tests := []struct {
+		name     string
+		filter   entryFilter
+		expected bool
+	}{
+		{
+			name:     "without filters",
+			filter:   entryFilter{},
+			expected: true,
+		},
+		{
+			name:     "with a matching include pattern",
+			filter:   entryFilter{includes: []string{"*.evtx"}},
+			expected: true,
+		},
+		{
+			name:     "with a matching include dir pattern",
+			filter:   entryFilter{includes: []string{"Windows/System32/winevt"}},
+			expected: true,
+		},
+		{
+			name:     "with a non-matching include pattern",
+			filter:   entryFilter{includes: []string{"*.log"}},
+			expected: false,
+		},
+		{
+			name:     "with a matching exclude pattern",
+			filter:   entryFilter{includes: []string{"*.evtx"}, excludes: []string{"Security.*"}},
+			expected: false,
+		},
+		{
+			name:     "with a smaller min size",
+			filter:   entryFilter{minSize: 1024},
+			expected: true,
+		},
+		{
+			name:     "with a larger min size",
+			filter:   entryFilter{minSize: 4096},
+			expected: false,
+		},
+		{
+			name:     "with a smaller max size",
+			filter:   entryFilter{maxSize: 1024},
+			expected: false,
+		},
+		{
+			name:     "with an earlier modified after time",
+			filter:   entryFilter{modifiedAfter: modTime.Add(-time.Hour)},
+			expected: true,
+		},
+		{
+			name:     "with a later modified after time",
+			filter:   entryFilter{modifiedAfter: modTime.Add(time.Hour)},
+			expected: false,
+		},
+		{
+			name:     "with an earlier modified before time",
+			filter:   entryFilter{modifiedBefore: modTime.Add(-time.Hour)},
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := tt.filter.match(entry)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		entry    string
+		expected bool
+	}{
+		{
+			name:     "with a base name pattern",
+			pattern:  "*.evtx",
+			entry:    "Logs/Security.evtx",
+			expected: true,
+		},
+		{
+			name:     "with a full path pattern",
+			pattern:  "Logs/*.evtx",
+			entry:    "Logs/Security.evtx",
+			expected: true,
+		},
+		{
+			name:     "with a parent dir pattern",
+			pattern:  "Windows/Logs",
+			entry:    "Windows/Logs/a/b.log",
+			expected: true,
+		},
+		{
+			name:     "with a dir entry",
+			pattern:  "Logs",
+			entry:    "Logs/",
+			expected: true,
+		},
+		{
+			name:     "with a non-matching pattern",
+			pattern:  "Windows/*.evtx",
+			entry:    "Logs/Security.evtx",
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := matchPattern(tt.pattern, tt.entry)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value     string
+		expected  int64
+		expectErr bool
+	}{
+		{value: "", expected: 0},
+		{value: "100", expected: 100},
+		{value: "100B", expected: 100},
+		{value: "10KB", expected: 10 * 1024},
+		{value: "10 mb", expected: 10 * 1024 * 1024},
+		{value: "2GB", expected: 2 * 1024 * 1024 * 1024},
+		{value: "-1", expectErr: true},
+		{value: "MB", expectErr: true},
+		{value: "8589934592GB", expectErr: true},
+		{value: "9223372036854775807", expected: math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			actual, err := parseSize(tt.value)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	actual, err := parseTime("2024-06-01")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), actual)
+
+	actual, err = parseTime("2024-06-01T12:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), actual)
+
+	actual, err = parseTime("")
+	require.NoError(t, err)
+	require.True(t, actual.IsZero())
+
+	_, err = parseTime("01/06/2024")
+	require.Error(t, err)
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	ntfsExtraID         = 0x000a
+	extendedTimeExtraID = 0x5455
+	aesExtraID          = 0x9901
+	methodAES           = 99
+
+	ntfsTimeTag       = 0x0001
+	ntfsEpochOffset   = 116444736000000000 // 100ns intervals from 1601 to 1970
+	dosTimePrecision  = 2 * time.Second
+	timeZoneStep      = 15 * time.Minute
+	maxTimeZoneOffset = 14 * time.Hour
+)
+
+// knownExtraIDs are the extra fields written by the common zip tools.
+var knownExtraIDs = map[uint16]bool{
+	zip64ExtraID:        true,
+	ntfsExtraID:         true,
+	0x000d:              true, // unix
+	extendedTimeExtraID: true,
+	0x5855:              true, // info-zip unix, old
+	0x7855:              true, // info-zip unix
+	unixOwnerExtraID:    true,
+	unicodePathExtraID:  true,
+	0x6375:              true, // unicode comment
+	aesExtraID:          true,
+	0xcafe:              true, // jar marker
+	0xd935:              true, // android alignment
+}
+
+var errMalformedExtra = errors.New("malformed extra field")
+
+type inspectReport struct {
+	FilePath string           `json:"file"`
+	Size     int64            `json:"size"`
+	Entries  int              `json:"entries"`
+	Comment  string           `json:"comment,omitempty"`
+	Findings []inspectFinding `json:"findings"`
+}
+
+type inspectFinding struct {
+	Offset   int64  `json:"offset"`
+	Entry    string `json:"entry,omitempty"`
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+type entrySpan struct {
+	name       string
+	start      int64
+	dataOffset int64
+	end        int64
+}
+
+// zipInspector reads the zip file after the prepended data its offsets don't
+// include, and reports the offsets from the start of the zip file.
+type zipInspector struct {
+	ctx      context.Context
+	file     io.ReaderAt
+	base     int64
+	reader   io.ReaderAt
+	size     int64
+	password string
+	now      time.Time
+	report   inspectReport
+}
+
+// inspectZipFile reports the structural anomalies of a zip file, which are
+// not needed to unzip it but may be signs of tampering: data outside of the
+// entries, entries sharing their data, local headers disagreeing with the
+// central directory, unusual extra fields and timestamps, and entry data
+// disagreeing with its crc-32 and size.
+func inspectZipFile(ctx context.Context, filePath string, password string) (inspectReport, error) {
+	zipReader, base, err := openInspectedZipFile(filePath)
+	if err != nil {
+		return inspectReport{}, err
+	}
+	defer zipReader.Close()
+
+	ins := &zipInspector{
+		ctx:      ctx,
+		file:     zipReader.volumes,
+		base:     base,
+		reader:   io.NewSectionReader(zipReader.volumes, base, zipReader.volumes.size-base),
+		size:     zipReader.volumes.size - base,
+		password: password,
+		now:      time.Now(),
+		report: inspectReport{
+			FilePath: filePath,
+			Size:     zipReader.volumes.size,
+			Entries:  len(zipReader.File),
+			Comment:  zipReader.Comment,
+		},
+	}
+	dirOffset, dirEnd, err := findDirectoryBounds(ins.reader, ins.size)
+	if err != nil {
+		return inspectReport{}, fmt.Errorf("failed to read central directory of '%s': %w", filePath, err)
+	}
+
+	names := make(map[string]int)
+	var spans []entrySpan
+	for _, zipEntry := range zipReader.File {
+		err = ctx.Err()
+		if err != nil {
+			return inspectReport{}, fmt.Errorf("context error: %w", err)
+		}
+		offset := zipEntry.HeaderOffset
+		names[zipEntry.Name]++
+		if names[zipEntry.Name] == 2 {
+			ins.addFinding(offset, zipEntry.Name, severityError, "duplicate-entry", "entry name is used by more than one entry")
+		}
+		ins.inspectExtra(offset, zipEntry.Name, "central", zipEntry.Extra)
+		ins.inspectTimestamps(offset, zipEntry)
+		if len(zipEntry.Comment) > 0 {
+			ins.addFinding(offset, zipEntry.Name, severityInfo, "entry-comment", "entry comment %q", zipEntry.Comment)
+		}
+		span, ok := ins.inspectLocalHeader(offset, zipEntry)
+		if !ok {
+			continue
+		}
+		spans = append(spans, span)
+		ins.inspectData(offset, zipEntry, span)
+	}
+	ins.inspectLayout(spans, dirOffset, dirEnd)
+	if len(zipReader.Comment) > 0 {
+		ins.addFinding(dirEnd-int64(len(zipReader.Comment)), "", severityInfo, "archive-comment", "archive comment %q", zipReader.Comment)
+	}
+
+	sort.SliceStable(ins.report.Findings, func(i, j int) bool {
+		return ins.report.Findings[i].Offset < ins.report.Findings[j].Offset
+	})
+	return ins.report, nil
+}
+
+// openInspectedZipFile opens a zip file like openZipFile, and also a zip file
+// with prepended data its offsets don't include, e.g. a self-extractor stub
+// concatenated with a zip file, returning the length of the prepended data.
+func openInspectedZipFile(filePath string) (*zipArchive, int64, error) {
+	volumes, err := openVolumes(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file '%s': %w", filePath, err)
+	}
+	var base int64
+	zipReader, err := zip.NewReader(volumes, volumes.size)
+	if errors.Is(err, zip.ErrFormat) && !volumes.spanned {
+		if base = findPrependedLen(volumes, volumes.size); base > 0 {
+			zipReader, err = zip.NewReader(io.NewSectionReader(volumes, base, volumes.size-base), volumes.size-base)
+		}
+	}
+	if err == nil {
+		err = volumes.fixEntryOffsets(zipReader.File)
+	}
+	if err != nil {
+		_ = volumes.Close()
+		return nil, 0, fmt.Errorf("failed to open file '%s': %w", filePath, err)
+	}
+	return &zipArchive{Reader: zipReader, volumes: volumes}, base, nil
+}
+
+func (ins *zipInspector) addFinding(offset int64, name string, severity string, check string, format string, args ...any) {
+	finding := inspectFinding{
+		Offset:   ins.base + offset,
+		Entry:    name,
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	ins.report.Findings = append(ins.report.Findings, finding)
+}
+
+// inspectLocalHeader compares the local header of an entry to its central
+// directory header, and returns the bytes taken by the entry.
+func (ins *zipInspector) inspectLocalHeader(offset int64, zipEntry *zip.File) (entrySpan, bool) {
+	local, isZip64, err := readLocalHeader(ins.reader, offset)
+	if err == nil && binary.LittleEndian.Uint32(local.header) != localHeaderSignature {
+		err = zip.ErrFormat
+	}
+	if err != nil {
+		ins.addFinding(offset, zipEntry.Name, severityError, "local-header", "failed to read local header: %s", err.Error())
+		return entrySpan{}, false
+	}
+	mismatch := func(field string, localValue any, centralValue any) {
+		ins.addFinding(offset, zipEntry.Name, severityError, "header-mismatch", "%s is %v in the local header but %v in the central header", field, localValue, centralValue)
+	}
+
+	if string(local.name) != zipEntry.Name {
+		mismatch("name", fmt.Sprintf("%q", local.name), fmt.Sprintf("%q", zipEntry.Name))
+	}
+	if local.flags() != zipEntry.Flags {
+		mismatch("flags", fmt.Sprintf("0x%04x", local.flags()), fmt.Sprintf("0x%04x", zipEntry.Flags))
+	}
+	method := binary.LittleEndian.Uint16(local.header[8:])
+	if data, ok := findExtraField(local.extra, aesExtraID); ok && method == methodAES && len(data) >= 7 {
+		method = binary.LittleEndian.Uint16(data[5:])
+	}
+	if method != zipEntry.Method {
+		mismatch("compression method", method, zipEntry.Method)
+	}
+	modifiedTime := binary.LittleEndian.Uint16(local.header[10:])
+	modifiedDate := binary.LittleEndian.Uint16(local.header[12:])
+	if modifiedTime != zipEntry.ModifiedTime || modifiedDate != zipEntry.ModifiedDate {
+		ins.addFinding(offset, zipEntry.Name, severityWarning, "timestamp", "modified time is %s in the local header but %s in the central header",
+			formatDOSTime(modifiedDate, modifiedTime), formatDOSTime(zipEntry.ModifiedDate, zipEntry.ModifiedTime))
+	}
+	ins.inspectExtra(offset, zipEntry.Name, "local", local.extra)
+
+	central := localEntry{crc32: zipEntry.CRC32, compressedSize: zipEntry.CompressedSize64, uncompressedSize: zipEntry.UncompressedSize64}
+	dataOffset := local.dataOffset(offset)
+	end := dataOffset + int64(zipEntry.CompressedSize64)
+	if end > ins.size || end < dataOffset {
+		ins.addFinding(offset, zipEntry.Name, severityError, "truncated-entry", "entry data ends at offset %d after the end of the file", end)
+		return entrySpan{}, false
+	}
+	source := "local header"
+	if local.hasDataDescriptor() {
+		// the local header may keep the values, or have zeros for them.
+		if !local.hasSizes(localEntry{}) && !local.hasSizes(central) {
+			mismatch("crc-32 and sizes", formatEntrySizes(local), formatEntrySizes(central))
+		}
+		source = "data descriptor"
+		end, err = readDescriptorAt(ins.reader, ins.size, end, isZip64, &local)
+		if err != nil {
+			ins.addFinding(offset, zipEntry.Name, severityError, "truncated-entry", "failed to read data descriptor: %s", err.Error())
+			return entrySpan{}, false
+		}
+	}
+	if !local.hasSizes(central) {
+		ins.addFinding(offset, zipEntry.Name, severityError, "header-mismatch", "crc-32 and sizes are %s in the %s but %s in the central header",
+			formatEntrySizes(local), source, formatEntrySizes(central))
+	}
+	return entrySpan{name: zipEntry.Name, start: offset, dataOffset: dataOffset, end: end}, true
+}
+
+func (e *localEntry) hasSizes(entry localEntry) bool {
+	return e.crc32 == entry.crc32 && e.compressedSize == entry.compressedSize && e.uncompressedSize == entry.uncompressedSize
+}
+
+// readDescriptorAt reads the data descriptor at the offset into the entry,
+// and returns the end of the descriptor.
+func readDescriptorAt(r io.ReaderAt, size int64, offset int64, isZip64 bool, entry *localEntry) (int64, error) {
+	buf := make([]byte, 24)
+	n, _ := r.ReadAt(buf[:min(int64(len(buf)), size-offset)], offset)
+	descriptor := buf[:n]
+	if n >= 4 && binary.LittleEndian.Uint32(descriptor) == dataDescriptorSignature {
+		descriptor = descriptor[4:]
+		offset += 4
+	}
+	descriptorLen := 12
+	if isZip64 {
+		descriptorLen = 20
+	}
+	if len(descriptor) < descriptorLen {
+		return 0, errNoDataDescriptor
+	}
+	entry.setDataDescriptor(descriptor, isZip64)
+	return offset + int64(descriptorLen), nil
+}
+
+// inspectData decompresses an entry to compare its data to the crc-32 and the
+// size of the central header. Encrypted entries are only checked with the
+// password.
+func (ins *zipInspector) inspectData(offset int64, zipEntry *zip.File, span entrySpan) {
+	if zipEntry.FileInfo().IsDir() && zipEntry.UncompressedSize64 == 0 {
+		return
+	}
+	var zipEntryReader io.ReadCloser
+	checkCRC := true
+	if zipEntry.IsEncrypted() {
+		if len(ins.password) == 0 {
+			ins.addFinding(offset, zipEntry.Name, severityInfo, "unverified-entry", "encrypted entry is not verified without the password")
+			return
+		}
+		var err error
+		zipEntryReader, err = openZipEntry(zipEntry, ins.password)
+		if err != nil {
+			ins.addFinding(offset, zipEntry.Name, severityError, "corrupt-entry", "%s", err.Error())
+			return
+		}
+		// the zip package checks the crc-32, which is zero in AES-2 entries.
+		checkCRC = false
+	} else {
+		decompressor := findDecompressor(zipEntry.Method, zipEntry.UncompressedSize64)
+		if decompressor == nil {
+			ins.addFinding(offset, zipEntry.Name, severityInfo, "unverified-entry", "compression method %d (%s) is not supported", zipEntry.Method, compressionMethodName(zipEntry.Method))
+			return
+		}
+		zipEntryReader = decompressor(io.NewSectionReader(ins.reader, span.dataOffset, int64(zipEntry.CompressedSize64)))
+	}
+	defer zipEntryReader.Close()
+
+	hash := crc32.NewIEEE()
+	size, err := io.Copy(hash, newContextReader(ins.ctx, zipEntryReader))
+	if errors.Is(err, zip.ErrChecksum) {
+		ins.addFinding(offset, zipEntry.Name, severityError, "crc-mismatch", "crc-32 of the data differs from the crc-32 of the central header")
+		return
+	}
+	if err != nil {
+		ins.addFinding(offset, zipEntry.Name, severityError, "corrupt-entry", "failed to decompress entry data: %s", err.Error())
+		return
+	}
+	if checkCRC && hash.Sum32() != zipEntry.CRC32 {
+		ins.addFinding(offset, zipEntry.Name, severityError, "crc-mismatch", "crc-32 of the data is %08x but %08x in the central header", hash.Sum32(), zipEntry.CRC32)
+	}
+	if uint64(size) != zipEntry.UncompressedSize64 {
+		ins.addFinding(offset, zipEntry.Name, severityError, "size-mismatch", "size of the data is %d but %d in the central header", size, zipEntry.UncompressedSize64)
+	}
+}
+
+// inspectLayout finds the bytes which aren't part of an entry or the central
+// directory, and the entries sharing their bytes.
+func (ins *zipInspector) inspectLayout(spans []entrySpan, dirOffset int64, dirEnd int64) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	if ins.base > 0 {
+		ins.inspectGap(-ins.base, 0, "prepended-data", "%d bytes before the zip file, which the offsets of the central directory don't include")
+	}
+	var prev entrySpan
+	for i, span := range spans {
+		if i == 0 && span.start > 0 {
+			ins.inspectGap(0, span.start, "prepended-data", "%d bytes before the first entry")
+		}
+		if i > 0 && span.start < prev.end {
+			ins.addFinding(span.start, span.name, severityError, "overlapping-entries", "entry overlaps entry '%s' by %d bytes", prev.name, min(prev.end, span.end)-span.start)
+		}
+		if i > 0 && span.start > prev.end {
+			ins.inspectGap(prev.end, span.start, "hidden-data", "%d bytes between the entries")
+		}
+		if span.end > prev.end {
+			prev = span
+		}
+	}
+	if len(spans) == 0 && dirOffset > 0 {
+		ins.inspectGap(0, dirOffset, "prepended-data", "%d bytes before the central directory")
+	}
+	if prev.end > dirOffset {
+		ins.addFinding(dirOffset, prev.name, severityError, "overlapping-entries", "entry overlaps the central directory by %d bytes", prev.end-dirOffset)
+	} else if len(spans) > 0 && prev.end < dirOffset {
+		ins.inspectGap(prev.end, dirOffset, "hidden-data", "%d bytes between the last entry and the central directory")
+	}
+	if dirEnd < ins.size {
+		ins.inspectGap(dirEnd, ins.size, "appended-data", "%d bytes after the end of the central directory")
+	}
+}
+
+// inspectGap reports the bytes between the offsets, which are an error if
+// they contain a local header, i.e. an entry removed from the central
+// directory.
+func (ins *zipInspector) inspectGap(start int64, end int64, check string, format string) {
+	for pos, signature := range findSignatures(ins.file, ins.base+end, ins.base+start) {
+		if signature == localHeaderSignature {
+			ins.addFinding(start, "", severityError, "hidden-entry", format+", containing a local header at offset %d", end-start, pos)
+			return
+		}
+	}
+	ins.addFinding(start, "", severityWarning, check, format, end-start)
+}
+
+// inspectExtra reports the extra fields not written by the common zip tools,
+// and the extra fields with invalid lengths.
+func (ins *zipInspector) inspectExtra(offset int64, name string, header string, extra []byte) {
+	ids, err := readExtraFieldIDs(extra)
+	for _, id := range ids {
+		if !knownExtraIDs[id] {
+			ins.addFinding(offset, name, severityWarning, "extra-field", "unusual extra field 0x%04x in the %s header", id, header)
+		}
+	}
+	if err != nil {
+		ins.addFinding(offset, name, severityError, "extra-field", "%s in the %s header", err.Error(), header)
+	}
+}
+
+func readExtraFieldIDs(extra []byte) ([]uint16, error) {
+	var ids []uint16
+	for len(extra) >= 4 {
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra)-4 {
+			return ids, errMalformedExtra
+		}
+		ids = append(ids, binary.LittleEndian.Uint16(extra))
+		extra = extra[4+size:]
+	}
+	// some zip tools pad the extra fields with zeros.
+	for _, b := range extra {
+		if b != 0 {
+			return ids, errMalformedExtra
+		}
+	}
+	return ids, nil
+}
+
+// inspectTimestamps reports invalid and future modified times, and the unix
+// and ntfs modified times disagreeing with the dos modified time. The dos
+// time is a local time, so it may differ from them by a time zone offset.
+func (ins *zipInspector) inspectTimestamps(offset int64, zipEntry *zip.File) {
+	// zip tools write a zero dos time when the modified time is unknown.
+	if zipEntry.ModifiedDate == 0 && zipEntry.ModifiedTime == 0 {
+		return
+	}
+	if !isValidDOSTime(zipEntry.ModifiedDate, zipEntry.ModifiedTime) {
+		ins.addFinding(offset, zipEntry.Name, severityWarning, "timestamp", "invalid modified time 0x%04x%04x", zipEntry.ModifiedDate, zipEntry.ModifiedTime)
+		return
+	}
+	modTime := zipEntry.ModTime()
+	if modTime.Sub(ins.now) > maxTimeZoneOffset {
+		ins.addFinding(offset, zipEntry.Name, severityWarning, "timestamp", "modified time %s is in the future", modTime.Format(time.DateTime))
+	}
+	for _, field := range []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"unix", readExtendedModTime(zipEntry.Extra)},
+		{"ntfs", readNTFSModTime(zipEntry.Extra)},
+	} {
+		if field.modTime.IsZero() {
+			continue
+		}
+		if !isTimeZoneOffset(field.modTime.Sub(modTime)) {
+			ins.addFinding(offset, zipEntry.Name, severityWarning, "timestamp", "%s modified time %s disagrees with the dos modified time %s",
+				field.name, field.modTime.UTC().Format(time.RFC3339), modTime.Format(time.DateTime))
+		}
+	}
+}
+
+func isTimeZoneOffset(diff time.Duration) bool {
+	diff = diff.Abs()
+	if diff > maxTimeZoneOffset+dosTimePrecision {
+		return false
+	}
+	remainder := diff % timeZoneStep
+	return remainder <= dosTimePrecision || remainder >= timeZoneStep-dosTimePrecision
+}
+
+func isValidDOSTime(dosDate uint16, dosTime uint16) bool {
+	month := dosDate >> 5 & 0xf
+	day := dosDate & 0x1f
+	return month >= 1 && month <= 12 && day >= 1 &&
+		dosTime>>11 <= 23 && dosTime>>5&0x3f <= 59 && dosTime&0x1f <= 29
+}
+
+func formatDOSTime(dosDate uint16, dosTime uint16) string {
+	header := zip.FileHeader{ModifiedDate: dosDate, ModifiedTime: dosTime}
+	return header.ModTime().Format(time.DateTime)
+}
+
+func formatEntrySizes(entry localEntry) string {
+	return fmt.Sprintf("%08x/%d/%d", entry.crc32, entry.compressedSize, entry.uncompressedSize)
+}
+
+// readExtendedModTime reads the unix modified time of the extended timestamp
+// extra field, which starts with the flags of the stored times.
+func readExtendedModTime(extra []byte) time.Time {
+	data, ok := findExtraField(extra, extendedTimeExtraID)
+	if !ok || len(data) < 5 || data[0]&0x1 == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(int32(binary.LittleEndian.Uint32(data[1:]))), 0)
+}
+
+// readNTFSModTime reads the modified time of the ntfs extra field, which is a
+// reserved field followed by tagged attributes.
+func readNTFSModTime(extra []byte) time.Time {
+	data, ok := findExtraField(extra, ntfsExtraID)
+	if !ok || len(data) < 4 {
+		return time.Time{}
+	}
+	data = data[4:]
+	for len(data) >= 4 {
+		tag := binary.LittleEndian.Uint16(data)
+		size := int(binary.LittleEndian.Uint16(data[2:]))
+		data = data[4:]
+		if size > len(data) {
+			break
+		}
+		if tag == ntfsTimeTag && size >= 8 {
+			ticks := binary.LittleEndian.Uint64(data)
+			if ticks < ntfsEpochOffset {
+				return time.Time{}
+			}
+			return time.Unix(0, int64(ticks-ntfsEpochOffset)*100)
+		}
+		data = data[size:]
+	}
+	return time.Time{}
+}
+
+// findDirectoryBounds finds the offset of the central directory and the end
+// of the end of central directory record with its comment.
+func findDirectoryBounds(r io.ReaderAt, size int64) (int64, int64, error) {
+	endOffset, end, err := findDirectoryEnd(r, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	dirEnd := endOffset + directoryEndLen + int64(binary.LittleEndian.Uint16(end[20:]))
+	dirOffset := binary.LittleEndian.Uint32(end[16:])
+	if dirOffset != math.MaxUint32 {
+		return int64(dirOffset), dirEnd, nil
+	}
+	loc := make([]byte, directory64LocLen)
+	_, err = r.ReadAt(loc, endOffset-directory64LocLen)
+	if err != nil || binary.LittleEndian.Uint32(loc) != directory64LocSignature {
+		return 0, 0, zip.ErrFormat
+	}
+	end64 := make([]byte, directory64EndLen)
+	_, err = r.ReadAt(end64, int64(binary.LittleEndian.Uint64(loc[8:])))
+	if err != nil || binary.LittleEndian.Uint32(end64) != directory64EndSignature {
+		return 0, 0, zip.ErrFormat
+	}
+	return int64(binary.LittleEndian.Uint64(end64[48:])), dirEnd, nil
+}
+
+func countInspectErrors(reports []inspectReport) int {
+	count := 0
+	for _, report := range reports {
+		for _, finding := range report.Findings {
+			if finding.Severity == severityError {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func printInspectReports(w io.Writer, reports []inspectReport, asJSON bool) error {
+	if asJSON {
+		for i := range reports {
+			if reports[i].Findings == nil {
+				reports[i].Findings = []inspectFinding{}
+			}
+		}
+		if reports == nil {
+			reports = []inspectReport{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	}
+	for _, report := range reports {
+		_, err := fmt.Fprintf(w, "%s: %d entries, %d bytes\n", report.FilePath, report.Entries, report.Size)
+		if err != nil {
+			return err
+		}
+		if len(report.Findings) == 0 {
+			_, err = fmt.Fprintln(w, "no issues found")
+			if err != nil {
+				return err
+			}
+		}
+		for _, finding := range report.Findings {
+			location := fmt.Sprintf("offset %d", finding.Offset)
+			if len(finding.Entry) > 0 {
+				location = fmt.Sprintf("%s: entry '%s'", location, finding.Entry)
+			}
+			_, err = fmt.Fprintf(w, "%s: %s: %s: %s\n", location, finding.Severity, finding.Check, finding.Message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
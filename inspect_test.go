@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectZipFile(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	writeEntries := func(t *testing.T) func(w *zip.Writer) {
+		return func(w *zip.Writer) {
+			for _, entry := range entries {
+				writeTestEntry(t, w, &zip.FileHeader{Name: entry.name, Method: zip.Deflate}, entry.content)
+			}
+		}
+	}
+	tests := []struct {
+		name           string
+		password       string
+		createFile     func(t *testing.T, password string) string
+		expectedChecks []string
+		expectedErrors int
+	}{
+		{
+			name: "with a clean zip file",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, writeEntries(t), nil)
+			},
+		},
+		{
+			name:     "with encrypted entries",
+			password: "password_1",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+		},
+		{
+			name: "with encrypted entries without the password",
+			createFile: func(t *testing.T, _ string) string {
+				return createTestZipFile(t, entries, "password_1")
+			},
+			expectedChecks: []string{"unverified-entry"},
+		},
+		{
+			name: "with duplicate entries and comments",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, func(w *zip.Writer) {
+					writeTestEntry(t, w, &zip.FileHeader{Name: "readme.txt", Comment: "first"}, "one")
+					writeTestEntry(t, w, &zip.FileHeader{Name: "readme.txt"}, "two")
+					require.NoError(t, w.SetComment("evidence"))
+				}, nil)
+			},
+			expectedChecks: []string{"archive-comment", "duplicate-entry", "entry-comment"},
+			expectedErrors: 1,
+		},
+		{
+			name: "with prepended and appended data",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, []byte("stub"), writeEntries(t), func(data []byte) []byte {
+					return append(data, "trailer"...)
+				})
+			},
+			expectedChecks: []string{"appended-data", "prepended-data"},
+		},
+		{
+			name: "with prepended data not included in the offsets",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, writeEntries(t), func(data []byte) []byte {
+					return append([]byte("stub"), data...)
+				})
+			},
+			expectedChecks: []string{"prepended-data"},
+		},
+		{
+			name: "with a hidden local header",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, []byte("PK\x03\x04hidden"), writeEntries(t), nil)
+			},
+			expectedChecks: []string{"hidden-entry"},
+			expectedErrors: 1,
+		},
+		{
+			name: "with a renamed local header",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, writeEntries(t), func(data []byte) []byte {
+					return bytes.Replace(data, []byte("logs/system.evtx"), []byte("logs/systen.evtx"), 1)
+				})
+			},
+			expectedChecks: []string{"header-mismatch"},
+			expectedErrors: 1,
+		},
+		{
+			name: "with overlapping entries",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, func(w *zip.Writer) {
+					writeTestEntry(t, w, &zip.FileHeader{Name: "readme.txt"}, "readme")
+					writeTestEntry(t, w, &zip.FileHeader{Name: "readme.txt"}, "readme")
+				}, func(data []byte) []byte {
+					// point the second central header to the first local header.
+					dirHeader := bytes.LastIndex(data, []byte("PK\x01\x02"))
+					binary.LittleEndian.PutUint32(data[dirHeader+42:], 0)
+					return data
+				})
+			},
+			expectedChecks: []string{"duplicate-entry", "hidden-entry", "overlapping-entries"},
+			expectedErrors: 3,
+		},
+		{
+			name: "with corrupted data",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, func(w *zip.Writer) {
+					writeTestEntry(t, w, &zip.FileHeader{Name: "readme.txt", Method: zip.Store}, "readme")
+				}, func(data []byte) []byte {
+					return bytes.Replace(data, []byte("readme\x50\x4b\x07\x08"), []byte("README\x50\x4b\x07\x08"), 1)
+				})
+			},
+			expectedChecks: []string{"crc-mismatch"},
+			expectedErrors: 1,
+		},
+		{
+			name: "with unusual extra fields and timestamps",
+			createFile: func(t *testing.T, _ string) string {
+				return createInspectTestZipFile(t, nil, func(w *zip.Writer) {
+					header := &zip.FileHeader{Name: "readme.txt", Extra: makeTestExtra(0x1234, []byte{0x01})}
+					header.ModifiedDate = 0x5a21 // 2025-01-01
+					header.ModifiedTime = 0x6000 // 12:00:00
+					modTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+					header.Extra = append(header.Extra, makeTestExtra(extendedTimeExtraID, binary.LittleEndian.AppendUint32([]byte{0x01}, uint32(modTime.Unix())))...)
+					writeTestEntry(t, w, header, "readme")
+				}, nil)
+			},
+			expectedChecks: []string{"extra-field", "timestamp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := tt.createFile(t, tt.password)
+			report, err := inspectZipFile(context.Background(), filePath, tt.password)
+			require.NoError(t, err)
+			require.Equal(t, filePath, report.FilePath)
+
+			checks := make(map[string]bool)
+			for _, finding := range report.Findings {
+				checks[finding.Check] = true
+			}
+			var actualChecks []string
+			for check := range checks {
+				actualChecks = append(actualChecks, check)
+			}
+			sort.Strings(actualChecks)
+			require.Equal(t, tt.expectedChecks, actualChecks, "findings: %v", report.Findings)
+			require.Equal(t, tt.expectedErrors, countInspectErrors([]inspectReport{report}))
+		})
+	}
+}
+
+func TestIsTimeZoneOffset(t *testing.T) {
+	require.True(t, isTimeZoneOffset(0))
+	require.True(t, isTimeZoneOffset(-3*time.Hour-time.Second))
+	require.True(t, isTimeZoneOffset(5*time.Hour+30*time.Minute))
+	require.False(t, isTimeZoneOffset(7*time.Minute))
+	require.False(t, isTimeZoneOffset(15*time.Hour))
+}
+
+func TestPrintInspectReports(t *testing.T) {
+	reports := []inspectReport{
+		{FilePath: "clean.zip", Size: 100, Entries: 1},
+		{
+			FilePath: "tampered.zip",
+			Size:     200,
+			Entries:  2,
+			Findings: []inspectFinding{
+				{Offset: 0, Severity: severityWarning, Check: "prepended-data", Message: "4 bytes before the first entry"},
+				{Offset: 4, Entry: "readme.txt", Severity: severityError, Check: "duplicate-entry", Message: "entry name is used by more than one entry"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, printInspectReports(&buf, reports, false))
+	expected := "clean.zip: 1 entries, 100 bytes\n" +
+		"no issues found\n" +
+		"tampered.zip: 2 entries, 200 bytes\n" +
+		"offset 0: warning: prepended-data: 4 bytes before the first entry\n" +
+		"offset 4: entry 'readme.txt': error: duplicate-entry: entry name is used by more than one entry\n"
+	require.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	require.NoError(t, printInspectReports(&buf, reports, true))
+	require.Contains(t, buf.String(), `"findings": []`)
+	require.Contains(t, buf.String(), `"check": "duplicate-entry"`)
+}
+
+// createInspectTestZipFile writes the prefix and the zip file written by fn
+// with its offsets including the prefix, and then modifies the bytes.
+func createInspectTestZipFile(t *testing.T, prefix []byte, fn func(w *zip.Writer), modify func(data []byte) []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.Write(prefix)
+	writer := zip.NewWriter(&buf)
+	writer.SetOffset(int64(len(prefix)))
+	fn(writer)
+	require.NoError(t, writer.Close())
+
+	data := buf.Bytes()
+	if modify != nil {
+		data = modify(data)
+	}
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	require.NoError(t, os.WriteFile(filePath, data, 0644))
+	return filePath
+}
+
+func writeTestEntry(t *testing.T, w *zip.Writer, header *zip.FileHeader, content string) {
+	t.Helper()
+	entryWriter, err := w.CreateHeader(header)
+	require.NoError(t, err)
+	_, err = entryWriter.Write([]byte(content))
+	require.NoError(t, err)
+}
+
+func makeTestExtra(id uint16, data []byte) []byte {
+	extra := binary.LittleEndian.AppendUint16(nil, id)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(data)))
+	return append(extra, data...)
+}
@@ -0,0 +1,382 @@
+// Package deflate64 implements a decompressor for the deflate64 (enhanced
+// deflate) format used by zip compression method 9.
+//
+// Deflate64 is deflate with a 64KB window, length code 285 storing lengths up
+// to 65538 in 16 extra bits and distance codes 30 and 31 for distances up to
+// 65536.
+package deflate64
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+const (
+	windowSize = 1 << 16
+	windowMask = windowSize - 1
+
+	maxCodeLen   = 15
+	numLitCodes  = 288
+	numDistCodes = 32
+)
+
+// ErrCorrupt is returned when the stream isn't a valid deflate64 stream.
+var ErrCorrupt = errors.New("deflate64: corrupt input")
+
+var lengthBases = [29]uint16{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+	35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 3,
+}
+
+var lengthExtraBits = [29]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+	3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 16,
+}
+
+var distBases = [numDistCodes]uint32{
+	1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+	257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577, 32769, 49153,
+}
+
+var distExtraBits = [numDistCodes]uint8{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+	7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14,
+}
+
+// codeLenOrder is the order of the code length code lengths of a dynamic
+// block.
+var codeLenOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// huffman is a canonical huffman code, decoded a bit at a time as in zlib's
+// puff.
+type huffman struct {
+	counts  [maxCodeLen + 1]uint16
+	symbols []uint16
+}
+
+func newHuffman(lengths []uint8) (*huffman, error) {
+	h := &huffman{symbols: make([]uint16, len(lengths))}
+	for _, length := range lengths {
+		h.counts[length]++
+	}
+	left := 1
+	for length := 1; length <= maxCodeLen; length++ {
+		left <<= 1
+		left -= int(h.counts[length])
+		if left < 0 {
+			return nil, ErrCorrupt
+		}
+	}
+	var offsets [maxCodeLen + 1]uint16
+	for length := 1; length < maxCodeLen; length++ {
+		offsets[length+1] = offsets[length] + h.counts[length]
+	}
+	for symbol, length := range lengths {
+		if length != 0 {
+			h.symbols[offsets[length]] = uint16(symbol)
+			offsets[length]++
+		}
+	}
+	return h, nil
+}
+
+var fixedLit, fixedDist = newFixedHuffmans()
+
+func newFixedHuffmans() (*huffman, *huffman) {
+	var lengths [numLitCodes]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	lit, _ := newHuffman(lengths[:])
+	var distLengths [numDistCodes]uint8
+	for i := range distLengths {
+		distLengths[i] = 5
+	}
+	dist, _ := newHuffman(distLengths[:])
+	return lit, dist
+}
+
+type reader struct {
+	r     io.ByteReader
+	bits  uint32
+	nbits uint
+	err   error
+
+	window  [windowSize]byte
+	written int64
+
+	final     bool
+	inBlock   bool
+	storedLen int
+	lit       *huffman
+	dist      *huffman
+
+	hasLiteral bool
+	literal    byte
+	copyLen    int
+	copyDist   int
+}
+
+// NewReader returns a ReadCloser that decompresses the deflate64 stream read
+// from r.
+func NewReader(r io.Reader) io.ReadCloser {
+	byteReader, ok := r.(io.ByteReader)
+	if !ok {
+		byteReader = bufio.NewReader(r)
+	}
+	return &reader{r: byteReader}
+}
+
+func (d *reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && d.err == nil {
+		switch {
+		case d.hasLiteral:
+			d.hasLiteral = false
+			p[n] = d.put(d.literal)
+			n++
+		case d.copyLen > 0:
+			p[n] = d.put(d.window[(int(d.written)-d.copyDist)&windowMask])
+			d.copyLen--
+			n++
+		case d.storedLen > 0:
+			var b uint32
+			b, d.err = d.readBits(8)
+			if d.err == nil {
+				p[n] = d.put(byte(b))
+				d.storedLen--
+				n++
+			}
+		default:
+			d.err = d.step()
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, d.err
+}
+
+func (d *reader) Close() error {
+	return nil
+}
+
+func (d *reader) put(b byte) byte {
+	d.window[d.written&windowMask] = b
+	d.written++
+	return b
+}
+
+// step reads a block header or the next symbol of a block.
+func (d *reader) step() error {
+	if !d.inBlock {
+		if d.final {
+			return io.EOF
+		}
+		return d.readBlockHeader()
+	}
+	symbol, err := d.decode(d.lit)
+	if err != nil {
+		return err
+	}
+	switch {
+	case symbol < 256:
+		d.hasLiteral = true
+		d.literal = byte(symbol)
+		return nil
+	case symbol == 256:
+		d.inBlock = false
+		return nil
+	case symbol > 285:
+		return ErrCorrupt
+	}
+	symbol -= 257
+	extra, err := d.readBits(uint(lengthExtraBits[symbol]))
+	if err != nil {
+		return err
+	}
+	length := int(lengthBases[symbol]) + int(extra)
+
+	symbol, err = d.decode(d.dist)
+	if err != nil {
+		return err
+	}
+	extra, err = d.readBits(uint(distExtraBits[symbol]))
+	if err != nil {
+		return err
+	}
+	dist := int(distBases[symbol]) + int(extra)
+	if int64(dist) > d.written {
+		return ErrCorrupt
+	}
+	d.copyLen = length
+	d.copyDist = dist
+	return nil
+}
+
+func (d *reader) readBlockHeader() error {
+	header, err := d.readBits(3)
+	if err != nil {
+		return err
+	}
+	d.final = header&1 == 1
+	switch header >> 1 {
+	case 0:
+		return d.readStoredHeader()
+	case 1:
+		d.lit, d.dist = fixedLit, fixedDist
+	case 2:
+		err = d.readDynamicHeader()
+		if err != nil {
+			return err
+		}
+	default:
+		return ErrCorrupt
+	}
+	d.inBlock = true
+	return nil
+}
+
+func (d *reader) readStoredHeader() error {
+	d.bits >>= d.nbits % 8
+	d.nbits -= d.nbits % 8
+	length, err := d.readBits(16)
+	if err != nil {
+		return err
+	}
+	complement, err := d.readBits(16)
+	if err != nil {
+		return err
+	}
+	if length != ^complement&0xffff {
+		return ErrCorrupt
+	}
+	d.storedLen = int(length)
+	return nil
+}
+
+func (d *reader) readDynamicHeader() error {
+	counts, err := d.readBits(14)
+	if err != nil {
+		return err
+	}
+	numLit := int(counts&0x1f) + 257
+	numDist := int(counts>>5&0x1f) + 1
+	numCodeLen := int(counts>>10) + 4
+	if numLit > 286 {
+		return ErrCorrupt
+	}
+
+	var codeLenLengths [len(codeLenOrder)]uint8
+	for i := 0; i < numCodeLen; i++ {
+		length, err := d.readBits(3)
+		if err != nil {
+			return err
+		}
+		codeLenLengths[codeLenOrder[i]] = uint8(length)
+	}
+	codeLen, err := newHuffman(codeLenLengths[:])
+	if err != nil {
+		return err
+	}
+
+	lengths := make([]uint8, numLit+numDist)
+	for i := 0; i < len(lengths); {
+		symbol, err := d.decode(codeLen)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+		var length uint8
+		var repeat uint32
+		switch symbol {
+		case 16:
+			if i == 0 {
+				return ErrCorrupt
+			}
+			length = lengths[i-1]
+			repeat, err = d.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = d.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > len(lengths) {
+			return ErrCorrupt
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = length
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return ErrCorrupt
+	}
+
+	d.lit, err = newHuffman(lengths[:numLit])
+	if err != nil {
+		return err
+	}
+	d.dist, err = newHuffman(lengths[numLit:])
+	return err
+}
+
+// decode reads the bits of a code from the most significant one.
+func (d *reader) decode(h *huffman) (int, error) {
+	code, first, index := 0, 0, 0
+	for length := 1; length <= maxCodeLen; length++ {
+		bit, err := d.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.counts[length])
+		if code-count < first {
+			return int(h.symbols[index+code-first]), nil
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	return 0, ErrCorrupt
+}
+
+// readBits reads n bits from the least significant one.
+func (d *reader) readBits(n uint) (uint32, error) {
+	for d.nbits < n {
+		b, err := d.r.ReadByte()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		d.bits |= uint32(b) << d.nbits
+		d.nbits += 8
+	}
+	value := d.bits & (1<<n - 1)
+	d.bits >>= n
+	d.nbits -= n
+	return value, nil
+}
@@ -0,0 +1,176 @@
+package deflate64
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	var text bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&text, "line %d\n", i)
+	}
+	random := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		expected   []byte
+	}{
+		{
+			name:       "with stored blocks",
+			compressed: compressTestDeflate(t, text.Bytes(), flate.NoCompression),
+			expected:   text.Bytes(),
+		},
+		{
+			name:       "with dynamic blocks",
+			compressed: compressTestDeflate(t, text.Bytes(), flate.BestCompression),
+			expected:   text.Bytes(),
+		},
+		{
+			name:       "with huffman only blocks",
+			compressed: compressTestDeflate(t, text.Bytes(), flate.HuffmanOnly),
+			expected:   text.Bytes(),
+		},
+		{
+			name:       "with a long match at a far distance",
+			compressed: makeTestDeflate64(random[:40000], 1000, 40000),
+			expected:   append(random[:40000:40000], random[:1000]...),
+		},
+		{
+			name:       "with the longest match at the farthest distance",
+			compressed: makeTestDeflate64(random, 65538, 1<<16),
+			expected:   append(append(random[:len(random):len(random)], random...), random[:2]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := io.ReadAll(NewReader(bytes.NewReader(tt.compressed)))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+// TestReaderWithDeflate64Files decodes the deflate64 entries of the zip files in
+// testdata and checks them against the CRC-32 and size in their headers. The
+// files must be made by a real deflate64 encoder, e.g. with
+// "7z a -tzip -mm=Deflate64 -mx=9", from input with matches longer than 258
+// bytes and farther than 32KB, so length code 285 and distance codes 30 and 31
+// are used.
+func TestReaderWithDeflate64Files(t *testing.T) {
+	filePaths, err := filepath.Glob(filepath.Join("testdata", "*.zip"))
+	require.NoError(t, err)
+	if len(filePaths) == 0 {
+		t.Skip("no deflate64 zip files in testdata")
+	}
+	for _, filePath := range filePaths {
+		reader, err := zip.OpenReader(filePath)
+		require.NoError(t, err)
+		defer reader.Close()
+		for _, entry := range reader.File {
+			if entry.Method != 9 {
+				continue
+			}
+			t.Run(filepath.Base(filePath)+"/"+entry.Name, func(t *testing.T) {
+				compressed, err := entry.OpenRaw()
+				require.NoError(t, err)
+				actual, err := io.ReadAll(NewReader(compressed))
+				require.NoError(t, err)
+				require.Equal(t, entry.UncompressedSize64, uint64(len(actual)))
+				require.Equal(t, entry.CRC32, crc32.ChecksumIEEE(actual))
+			})
+		}
+	}
+}
+
+func TestReaderWithCorruptInput(t *testing.T) {
+	compressed := makeTestDeflate64([]byte("deflate64"), 3, 100)
+	_, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	compressed = makeTestDeflate64([]byte("deflate64"), 3, 9)
+	_, err = io.ReadAll(NewReader(bytes.NewReader(compressed[:len(compressed)-2])))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func compressTestDeflate(t *testing.T, data []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, level)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+// makeTestDeflate64 stores the data in stored blocks and copies length bytes
+// from the distance in a fixed block, using length code 285 and the distance
+// codes of deflate64.
+func makeTestDeflate64(data []byte, length int, dist int) []byte {
+	var w testBitWriter
+	for len(data) > 0 {
+		block := data[:min(len(data), 0xffff)]
+		data = data[len(block):]
+		w.writeBits(0, 3) // stored block
+		w.align()
+		w.writeBits(uint32(len(block)), 16)
+		w.writeBits(^uint32(len(block))&0xffff, 16)
+		w.buf = append(w.buf, block...)
+	}
+
+	w.writeBits(1|1<<1, 3) // final fixed block
+	w.writeCode(0xc0+285-280, 8)
+	w.writeBits(uint32(length-3), 16)
+	distCode := 0
+	for distCode+1 < len(distBases) && int(distBases[distCode+1]) <= dist {
+		distCode++
+	}
+	w.writeCode(uint32(distCode), 5)
+	w.writeBits(uint32(dist)-distBases[distCode], uint(distExtraBits[distCode]))
+	w.writeCode(0, 7) // end of block
+	w.align()
+	return w.buf
+}
+
+type testBitWriter struct {
+	buf   []byte
+	bits  uint32
+	nbits uint
+}
+
+func (w *testBitWriter) writeBits(value uint32, n uint) {
+	for i := uint(0); i < n; i++ {
+		w.bits |= (value >> i & 1) << w.nbits
+		w.nbits++
+		if w.nbits == 8 {
+			w.buf = append(w.buf, byte(w.bits))
+			w.bits, w.nbits = 0, 0
+		}
+	}
+}
+
+// writeCode writes a huffman code from its most significant bit.
+func (w *testBitWriter) writeCode(code uint32, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBits(code>>(i-1)&1, 1)
+	}
+}
+
+func (w *testBitWriter) align() {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+}
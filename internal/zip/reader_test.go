@@ -0,0 +1,96 @@
+package zip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestReadDirectoryHeaderZip64(t *testing.T) {
+	tests := []struct {
+		name             string
+		uncompressedSize uint32
+		compressedSize   uint32
+		offset           uint32
+		fields           []uint64
+		expected         [3]uint64
+		expectErr        bool
+	}{
+		{
+			name:             "with sizes",
+			uncompressedSize: math.MaxUint32,
+			compressedSize:   math.MaxUint32,
+			offset:           100,
+			fields:           []uint64{5 << 30, 6 << 30},
+			expected:         [3]uint64{5 << 30, 6 << 30, 100},
+		},
+		{
+			name:             "with an uncompressed size",
+			uncompressedSize: math.MaxUint32,
+			compressedSize:   1000,
+			offset:           100,
+			fields:           []uint64{5 << 30},
+			expected:         [3]uint64{5 << 30, 1000, 100},
+		},
+		{
+			name:             "with an offset",
+			uncompressedSize: 10,
+			compressedSize:   20,
+			offset:           math.MaxUint32,
+			fields:           []uint64{5 << 30},
+			expected:         [3]uint64{10, 20, 5 << 30},
+		},
+		{
+			name:             "with an uncompressed size and an offset",
+			uncompressedSize: math.MaxUint32,
+			compressedSize:   20,
+			offset:           math.MaxUint32,
+			fields:           []uint64{5 << 30, 6 << 30},
+			expected:         [3]uint64{5 << 30, 20, 6 << 30},
+		},
+		{
+			name:             "with a missing field",
+			uncompressedSize: math.MaxUint32,
+			compressedSize:   math.MaxUint32,
+			offset:           100,
+			fields:           []uint64{5 << 30},
+			expectErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extra := binary.LittleEndian.AppendUint16(nil, zip64ExtraId)
+			extra = binary.LittleEndian.AppendUint16(extra, uint16(len(tt.fields)*8))
+			for _, field := range tt.fields {
+				extra = binary.LittleEndian.AppendUint64(extra, field)
+			}
+			name := "file_1.txt"
+			header := make([]byte, directoryHeaderLen)
+			binary.LittleEndian.PutUint32(header, directoryHeaderSignature)
+			binary.LittleEndian.PutUint32(header[20:], tt.compressedSize)
+			binary.LittleEndian.PutUint32(header[24:], tt.uncompressedSize)
+			binary.LittleEndian.PutUint16(header[28:], uint16(len(name)))
+			binary.LittleEndian.PutUint16(header[30:], uint16(len(extra)))
+			binary.LittleEndian.PutUint32(header[42:], tt.offset)
+			header = append(header, name...)
+			header = append(header, extra...)
+
+			f := new(File)
+			err := readDirectoryHeader(f, bytes.NewReader(header))
+			if tt.expectErr {
+				if err != ErrFormat {
+					t.Fatalf("err = %v, want %v", err, ErrFormat)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := [3]uint64{f.UncompressedSize64, f.CompressedSize64, uint64(f.HeaderOffset)}
+			if actual != tt.expected {
+				t.Fatalf("sizes and offset = %v, want %v", actual, tt.expected)
+			}
+		})
+	}
+}
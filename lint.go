@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+type lintIssue struct {
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+func lintCSVFile(dirPath string, csvFilePath string, opts csvOptions) ([]lintIssue, error) {
+	lines, err := readCSVLines(csvFilePath, opts.delimiter, -1)
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			issue := lintIssue{
+				Line:     parseErr.Line,
+				Severity: severityError,
+				Check:    "parse",
+				Message:  parseErr.Err.Error(),
+			}
+			return []lintIssue{issue}, nil
+		}
+		return nil, err
+	}
+
+	var issues []lintIssue
+	addIssue := func(lineNum int, severity string, check string, format string, args ...any) {
+		issue := lintIssue{
+			Line:     lineNum,
+			Severity: severity,
+			Check:    check,
+			Message:  fmt.Sprintf(format, args...),
+		}
+		issues = append(issues, issue)
+	}
+
+	if len(lines) == 0 {
+		addIssue(0, severityError, "line-count", "csv file is empty")
+		return issues, nil
+	}
+	err = validateLineCount(lines)
+	if err != nil {
+		addIssue(0, severityError, "line-count", "%s", err.Error())
+	}
+	header := lines[0]
+	err = validateHeaderColCount(header)
+	if err != nil {
+		addIssue(1, severityError, "header", "%s", err.Error())
+	}
+	cols, err := findColIndexes(header, opts)
+	if err != nil {
+		addIssue(1, severityError, "header", "%s", err.Error())
+		return issues, nil
+	}
+	if cols.filename == cols.password {
+		addIssue(1, severityError, "header", "filename and password columns are the same")
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) != len(header) {
+			addIssue(i+1, severityError, "ragged-row", "expected %d columns but found %d", len(header), len(lines[i]))
+			lines[i] = padLine(lines[i], len(header))
+		}
+	}
+
+	validator := newCSVRowValidator(cols, opts.allowSubdirs)
+	validLineNums := make(map[int]bool)
+	for i := 1; i < len(lines); i++ {
+		if validator.validate(i+1, lines[i]) {
+			validLineNums[i+1] = true
+		}
+	}
+	for _, lineNum := range validator.emptyLineNums {
+		addIssue(lineNum, severityError, "empty-filename", "empty filename")
+	}
+	sort.Ints(validator.duplicateLineNums)
+	for _, lineNum := range validator.duplicateLineNums {
+		addIssue(lineNum, severityError, "duplicate-filename", "duplicate filename '%s'", lines[lineNum-1][cols.filename])
+	}
+	for _, lineNum := range validator.insecureLineNums {
+		addIssue(lineNum, severityError, "insecure-filename", "insecure filename '%s'", lines[lineNum-1][cols.filename])
+	}
+
+	var files []zipFile
+	lineNums := make(map[string]int)
+	for i := 1; i < len(lines); i++ {
+		lineNum := i + 1
+		filename := lines[i][cols.filename]
+		if strings.TrimSpace(filename) != filename {
+			addIssue(lineNum, severityWarning, "padded-filename", "filename '%s' has leading or trailing whitespace", filename)
+		}
+		if len(lines[i][cols.password]) == 0 {
+			addIssue(lineNum, severityWarning, "missing-password", "missing password for '%s'", filename)
+		}
+		if len(dirPath) == 0 || !validLineNums[lineNum] {
+			continue
+		}
+		file := zipFile{
+			path:     filepath.Join(dirPath, filename),
+			password: lines[i][cols.password],
+		}
+		files = append(files, file)
+		lineNums[file.path] = lineNum
+	}
+
+	if len(dirPath) == 0 {
+		return issues, nil
+	}
+
+	for _, file := range files {
+		fileInfo, err := os.Stat(file.path)
+		if err != nil {
+			addIssue(lineNums[file.path], severityError, "missing-file", "failed to get file info for '%s': %s", file.path, err.Error())
+			continue
+		}
+		if !fileInfo.Mode().IsRegular() {
+			addIssue(lineNums[file.path], severityError, "irregular-file", "'%s' is not a regular file", file.path)
+		}
+	}
+
+	rec, err := reconcileZipFiles(dirPath, files, opts.allowSubdirs)
+	if err != nil {
+		return nil, err
+	}
+	for _, mismatch := range rec.caseMismatches {
+		addIssue(lineNums[mismatch.csvPath], severityWarning, "case-mismatch", "'%s' is found as '%s' in the dir", mismatch.csvPath, mismatch.dirPath)
+	}
+	for _, path := range rec.unlisted {
+		addIssue(0, severityWarning, "unlisted-file", "'%s' is not listed in the csv file", path)
+	}
+
+	return issues, nil
+}
+
+func padLine(line []string, colCount int) []string {
+	if len(line) >= colCount {
+		return line
+	}
+	padded := make([]string, colCount)
+	copy(padded, line)
+	return padded
+}
+
+func countLintErrors(issues []lintIssue) int {
+	count := 0
+	for _, issue := range issues {
+		if issue.Severity == severityError {
+			count++
+		}
+	}
+	return count
+}
+
+func printLintIssues(w io.Writer, issues []lintIssue, asJSON bool) error {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+	if asJSON {
+		if issues == nil {
+			issues = []lintIssue{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(issues)
+	}
+	if len(issues) == 0 {
+		_, err := fmt.Fprintln(w, "no issues found")
+		return err
+	}
+	for _, issue := range issues {
+		location := "file"
+		if issue.Line > 0 {
+			location = fmt.Sprintf("line %d", issue.Line)
+		}
+		_, err := fmt.Fprintf(w, "%s: %s: %s: %s\n", location, issue.Severity, issue.Check, issue.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
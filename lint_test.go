@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintCSVFile(t *testing.T) {
+	dirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirPath)
+
+	for _, name := range []string{"file_1.zip", "file_2.zip", "file_3.zip"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dirPath, name), nil, 0644))
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		dirPath  string
+		expected []lintIssue
+	}{
+		{
+			name:     "with a valid csv file",
+			content:  "File Name,Zip Password\nfile_1.zip,password_1\nfile_2.zip,password_2\nfile_3.zip,password_3\n",
+			dirPath:  dirPath,
+			expected: nil,
+		},
+		{
+			name:    "with an unparsable csv file",
+			content: "File Name,Zip Password\n\"file_1.zip,password_1\n",
+			dirPath: dirPath,
+			expected: []lintIssue{
+				{Line: 2, Severity: severityError, Check: "parse", Message: "extraneous or missing \" in quoted-field"},
+			},
+		},
+		{
+			name:    "without data",
+			content: "File Name,Zip Password\n",
+			expected: []lintIssue{
+				{Line: 0, Severity: severityError, Check: "line-count", Message: "csv file doesn't have any data"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			csvFilePath, err := createTempFile("", "test*.csv", []byte(tt.content))
+			require.NoError(t, err)
+			defer os.Remove(csvFilePath)
+
+			actual, err := lintCSVFile(tt.dirPath, csvFilePath, csvOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestLintCSVFileWithEveryProblem(t *testing.T) {
+	dirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirPath)
+
+	for _, name := range []string{"file_1.zip", "file_2.zip", "file_3.zip"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dirPath, name), nil, 0644))
+	}
+
+	content := "File Name,Zip Password\nfile_1.zip,\n,password_2\nfile_1.zip,password_3,extra\n../file_4.zip,password_4\n file_2.zip ,password_5\nfile_5.zip,password_6\n"
+	csvFilePath, err := createTempFile("", "test*.csv", []byte(content))
+	require.NoError(t, err)
+	defer os.Remove(csvFilePath)
+
+	expected := []lintIssue{
+		{Line: 4, Severity: severityError, Check: "ragged-row", Message: "expected 2 columns but found 3"},
+		{Line: 3, Severity: severityError, Check: "empty-filename", Message: "empty filename"},
+		{Line: 2, Severity: severityError, Check: "duplicate-filename", Message: "duplicate filename 'file_1.zip'"},
+		{Line: 4, Severity: severityError, Check: "duplicate-filename", Message: "duplicate filename 'file_1.zip'"},
+		{Line: 5, Severity: severityError, Check: "insecure-filename", Message: "insecure filename '../file_4.zip'"},
+		{Line: 2, Severity: severityWarning, Check: "missing-password", Message: "missing password for 'file_1.zip'"},
+		{Line: 6, Severity: severityWarning, Check: "padded-filename", Message: "filename ' file_2.zip ' has leading or trailing whitespace"},
+	}
+	actual, err := lintCSVFile(dirPath, csvFilePath, csvOptions{})
+	require.NoError(t, err)
+	require.Subset(t, actual, expected)
+
+	checks := make(map[string]int)
+	for _, issue := range actual {
+		checks[issue.Check]++
+	}
+	require.Equal(t, 2, checks["missing-file"])
+	require.Equal(t, 2, checks["unlisted-file"])
+}
+
+func TestCountLintErrors(t *testing.T) {
+	issues := []lintIssue{
+		{Severity: severityError},
+		{Severity: severityWarning},
+		{Severity: severityError},
+	}
+	require.Equal(t, 2, countLintErrors(issues))
+}
+
+func TestPrintLintIssues(t *testing.T) {
+	issues := []lintIssue{
+		{Line: 3, Severity: severityError, Check: "empty-filename", Message: "empty filename"},
+		{Line: 0, Severity: severityWarning, Check: "unlisted-file", Message: "'file_1.zip' is not listed in the csv file"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printLintIssues(&buf, issues, false))
+	require.Equal(t, "file: warning: unlisted-file: 'file_1.zip' is not listed in the csv file\nline 3: error: empty-filename: empty filename\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printLintIssues(&buf, issues, true))
+	var actual []lintIssue
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+	require.Len(t, actual, 2)
+
+	buf.Reset()
+	require.NoError(t, printLintIssues(&buf, nil, true))
+	require.Equal(t, "[]\n", buf.String())
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
 	"syscall"
 
 	"github.com/urfave/cli/v2"
@@ -17,20 +18,69 @@ const (
 	dirFlagUsage = "dir path to unzip"
 	csvFlagUsage = "path for the csv file containing a list of zip files names and passwords to unzip. use this flag with the dir flag."
 
-	fileFlagUsage     = "path for the file to unzip"
+	csvDelimiterFlagUsage    = "delimiter for the csv file (e.g. ',', ';' or 'tab'). detected from the header line if not provided."
+	filenameColFlagUsage     = "name or 1-based number of the csv column containing the zip file names. defaults to the \"File Name\" column or the first column."
+	passwordColFlagUsage     = "name or 1-based number of the csv column containing the zip file passwords. defaults to the \"Zip Password\" column or the last column."
+	allowSubdirsFlagUsage    = "allow the csv file names to be relative paths to zip files in subdirectories of the dir path."
+	unlistedFlagUsage        = "action for zip files in the dir path that are not listed in the csv file: report, fail or extract."
+	defaultPasswordFlagUsage = "password for the unlisted zip files. use this flag with the unlisted flag set to extract."
+
+	fileFlagUsage     = "path for the file to unzip, or - to read it from stdin"
 	passwordFlagUsage = "password for the zip file. use this flag with the file flag if the input file is encrypted."
+
+	includeFlagUsage        = "glob pattern for the zip entries to unzip (e.g. '*.evtx' or 'Windows/Logs'). can be repeated."
+	excludeFlagUsage        = "glob pattern for the zip entries to skip. can be repeated."
+	minSizeFlagUsage        = "minimum size of the zip entries to unzip (e.g. 10KB)"
+	maxSizeFlagUsage        = "maximum size of the zip entries to unzip (e.g. 100MB)"
+	modifiedAfterFlagUsage  = "unzip only the zip entries modified after the given date (YYYY-MM-DD or RFC 3339)"
+	modifiedBeforeFlagUsage = "unzip only the zip entries modified before the given date (YYYY-MM-DD or RFC 3339)"
+
+	recursiveArchivesFlagUsage = "max depth for unzipping nested zip and gzip files found in the zip files into sibling dirs. 0 disables it."
+	windowsPathsFlagUsage      = "action for zip entry names with backslashes or drive letters: reject the zip file, or normalize them to slashes and drive dirs (e.g. C/Windows)."
+	insecureEntriesFlagUsage   = "action for zip entries with insecure paths: reject the zip file, skip them, or sanitize them into the _insecure dir with a mapping file."
+	portableNamesFlagUsage     = "rename the zip entries to be usable on windows file systems and smb shares, e.g. by replacing ':' and '?' and renaming entries differing only in case."
+	symlinksFlagUsage          = "action for symlink zip entries: skip them, write them as files containing the target, or create them if the target stays in the unzip dir."
+	modePolicyFlagUsage        = "policy for the modes of the unzipped files and dirs: preserve-safe keeps the zip entry modes without the special bits, umask uses the default modes and fixed uses the file and dir mode flags. dirs are always traversable."
+	fileModeFlagUsage          = "octal mode for the unzipped files. use this flag with the mode policy set to fixed. (default: 0644)"
+	dirModeFlagUsage           = "octal mode for the unzipped dirs. use this flag with the mode policy set to fixed. (default: 0755)"
+	restoreOwnerFlagUsage      = "restore the unix owners of the zip entries if they are stored in the zip file. only used when running as root."
+	sealFlagUsage              = "remove the write permissions from the unzipped files and dirs after a zip file is unzipped without errors. use the unseal command to restore them."
+	xattrsFlagUsage            = "tag the unzipped files with user.biunzip.* extended attributes recording the zip file path and sha-256, the entry name and crc-32, and the unzip time. linux only."
+	progressFlagUsage          = "log the progress of the zip entries of at least 1GB every 10 percent."
+	recoverFlagUsage           = "rebuild the entry list of truncated or damaged zip files from the local headers, unzip the intact entries and report the unrecoverable ones."
+	nameEncodingFlagUsage      = "encoding for the zip entry names not marked as utf-8 (e.g. cp437, cp866, cp1252 or shift_jis). names are used as is if not provided."
+
+	catFileFlagUsage = "path for the zip file containing the entry"
+	entryFlagUsage   = "name or glob pattern of the zip entry to print. the pattern must match a single entry."
+
+	extractPasswordFlagUsage = "password for the zip files if they are encrypted"
+	toTarFlagUsage           = "path for a tar file to write the unzipped entries to instead of the disk. use - to write to stdout."
+
+	inspectPasswordFlagUsage = "password for the zip files. provide it to also check the crc-32 and sizes of the encrypted entries."
+
+	csvInitDirFlagUsage     = "dir path containing the zip files to list"
+	csvInitCSVFlagUsage     = "path for the csv file to create. use - to write to stdout."
+	csvInitSubdirsFlagUsage = "also list zip files in subdirectories of the dir path."
+
+	csvLintCSVFlagUsage = "path for the csv file to check"
+	csvLintDirFlagUsage = "dir path containing the zip files listed in the csv file. provide it to also check the files."
+	jsonFlagUsage       = "print the output as json"
 )
 
 var (
-	errEmptyCSVFilePath = errors.New("please provide the csv file path along with the directory path to unzip files in the directory")
-	errUnexpectedFlag   = errors.New("please provide both the directory and csv file paths to unzip files in the directory, or provide a file path to unzip a single file. if the file is encrypted, include the password")
+	errEmptyCSVFilePath       = errors.New("please provide the csv file path along with the directory path to unzip files in the directory")
+	errNegativeRecursiveDepth = errors.New("recursive archives depth can't be negative")
+	errNoDirs                 = errors.New("please provide the paths of the dirs to unseal")
+	errNoInspectFiles         = errors.New("please provide the paths of the zip files to inspect")
+	errNoZipFiles             = errors.New("please provide the paths of the zip files to unzip")
+	errUnexpectedFlag         = errors.New("please provide both the directory and csv file paths to unzip files in the directory, or provide a file path to unzip a single file. if the file is encrypted, include the password")
 )
 
 func main() {
 	app := cli.App{
 		Name:  "biunzip",
 		Usage: "unzip zip files",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.PathFlag{
 				Name:    "dir",
 				Aliases: []string{"d"},
@@ -41,6 +91,15 @@ func main() {
 				Aliases: []string{"c"},
 				Usage:   csvFlagUsage,
 			},
+			&cli.StringFlag{
+				Name:  "unlisted",
+				Usage: unlistedFlagUsage,
+				Value: unlistedModeReport,
+			},
+			&cli.StringFlag{
+				Name:  "default-password",
+				Usage: defaultPasswordFlagUsage,
+			},
 			&cli.PathFlag{
 				Name:    "file",
 				Aliases: []string{"f"},
@@ -51,8 +110,129 @@ func main() {
 				Aliases: []string{"p"},
 				Usage:   passwordFlagUsage,
 			},
-		},
+		}, append(newCSVFlags(), newUnzipFlags()...)...),
 		Action: run,
+		Commands: []*cli.Command{
+			{
+				Name:  "cat",
+				Usage: "print the content of a zip entry to stdout",
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    catFileFlagUsage,
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "password",
+						Aliases: []string{"p"},
+						Usage:   passwordFlagUsage,
+					},
+					&cli.StringFlag{
+						Name:     "entry",
+						Aliases:  []string{"e"},
+						Usage:    entryFlagUsage,
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "name-encoding",
+						Usage: nameEncodingFlagUsage,
+					},
+				},
+				Action: runCat,
+			},
+			{
+				Name:      "extract",
+				Usage:     "unzip one or more zip files to disk or to a tar stream",
+				ArgsUsage: "zip_file_path...",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "password",
+						Aliases: []string{"p"},
+						Usage:   extractPasswordFlagUsage,
+					},
+					&cli.PathFlag{
+						Name:  "to-tar",
+						Usage: toTarFlagUsage,
+					},
+				}, newUnzipFlags()...),
+				Action: runExtract,
+			},
+			{
+				Name:      "inspect",
+				Usage:     "report the structural anomalies of one or more zip files, e.g. to check them for tampering",
+				ArgsUsage: "zip_file_path...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "password",
+						Aliases: []string{"p"},
+						Usage:   inspectPasswordFlagUsage,
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: jsonFlagUsage,
+					},
+				},
+				Action: runInspect,
+			},
+			{
+				Name:      "unseal",
+				Usage:     "restore the write permissions of dirs unzipped with the seal flag",
+				ArgsUsage: "dir_path...",
+				Action:    runUnseal,
+			},
+			{
+				Name:  "csv",
+				Usage: "manage csv files used for unzipping zip files in a directory",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "init",
+						Usage: "create a csv file listing the zip files in a directory",
+						Flags: []cli.Flag{
+							&cli.PathFlag{
+								Name:     "dir",
+								Aliases:  []string{"d"},
+								Usage:    csvInitDirFlagUsage,
+								Required: true,
+							},
+							&cli.PathFlag{
+								Name:    "csv",
+								Aliases: []string{"c"},
+								Usage:   csvInitCSVFlagUsage,
+								Value:   "-",
+							},
+							&cli.BoolFlag{
+								Name:  "allow-subdirs",
+								Usage: csvInitSubdirsFlagUsage,
+							},
+						},
+						Action: runCSVInit,
+					},
+					{
+						Name:  "lint",
+						Usage: "report every problem found in a csv file",
+						Flags: append([]cli.Flag{
+							&cli.PathFlag{
+								Name:     "csv",
+								Aliases:  []string{"c"},
+								Usage:    csvLintCSVFlagUsage,
+								Required: true,
+							},
+							&cli.PathFlag{
+								Name:    "dir",
+								Aliases: []string{"d"},
+								Usage:   csvLintDirFlagUsage,
+							},
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: jsonFlagUsage,
+							},
+						}, newCSVFlags()...),
+						Action: runCSVLint,
+					},
+				},
+			},
+		},
 	}
 
 	ctx, cancelFunc := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -60,11 +240,11 @@ func main() {
 
 	err := app.RunContext(ctx, os.Args)
 	if err != nil {
-		fmt.Println()
-		fmt.Println("errors:")
-		fmt.Println(err.Error())
-		fmt.Println()
-		fmt.Println("exit status 1")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "errors:")
+		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "exit status 1")
 		os.Exit(1)
 	}
 }
@@ -76,12 +256,326 @@ func run(ctx *cli.Context) error {
 		if len(csvFilePath) == 0 {
 			return errEmptyCSVFilePath
 		}
-		return unzipDir(ctx.Context, dirPath, csvFilePath)
+		opts, err := parseCSVOptions(ctx)
+		if err != nil {
+			return err
+		}
+		opts.unlistedMode = ctx.String("unlisted")
+		err = validateUnlistedMode(opts.unlistedMode)
+		if err != nil {
+			return err
+		}
+		opts.defaultPassword = ctx.String("default-password")
+		unzipOpts, err := parseUnzipOptions(ctx)
+		if err != nil {
+			return err
+		}
+		return unzipDir(ctx.Context, dirPath, csvFilePath, opts, unzipOpts)
 	}
 	filePath := ctx.Path("file")
 	if len(filePath) > 0 {
 		password := ctx.String("password")
-		return unzipFile(ctx.Context, filePath, password)
+		unzipOpts, err := parseUnzipOptions(ctx)
+		if err != nil {
+			return err
+		}
+		if filePath == "-" {
+			// the stored modes are only in the central directory, so stdin
+			// uses the default modes unless a policy is given, to unzip it
+			// while it is read.
+			if !ctx.IsSet("mode-policy") {
+				unzipOpts.modes.policy = modePolicyUmask
+			}
+			return unzipStdin(ctx.Context, os.Stdin, password, unzipOpts)
+		}
+		return unzipFile(ctx.Context, filePath, password, unzipOpts)
 	}
 	return errUnexpectedFlag
 }
+
+func runCat(ctx *cli.Context) error {
+	nameEncoding, err := parseNameEncoding(ctx.String("name-encoding"))
+	if err != nil {
+		return err
+	}
+	return catEntry(ctx.Context, os.Stdout, ctx.Path("file"), ctx.String("password"), ctx.String("entry"), nameEncoding)
+}
+
+func runExtract(ctx *cli.Context) error {
+	filePaths := ctx.Args().Slice()
+	if len(filePaths) == 0 {
+		return errNoZipFiles
+	}
+	password := ctx.String("password")
+	opts, err := parseUnzipOptions(ctx)
+	if err != nil {
+		return err
+	}
+	tarPath := ctx.Path("to-tar")
+	if len(tarPath) > 0 {
+		if tarPath == "-" {
+			opts.logWriter = os.Stderr
+		}
+		return extractToTar(ctx.Context, tarPath, filePaths, password, opts)
+	}
+	scheduler := newUnzipScheduler(ctx.Context, runtime.NumCPU(), opts)
+	for _, filePath := range filePaths {
+		scheduler.schedule(zipFile{path: filePath, password: password})
+	}
+	errs := scheduler.wait()
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	return nil
+}
+
+func runInspect(ctx *cli.Context) error {
+	filePaths := ctx.Args().Slice()
+	if len(filePaths) == 0 {
+		return errNoInspectFiles
+	}
+	var reports []inspectReport
+	var errs []error
+	for _, filePath := range filePaths {
+		report, err := inspectZipFile(ctx.Context, filePath, ctx.String("password"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+	err := printInspectReports(os.Stdout, reports, ctx.Bool("json"))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	errCount := countInspectErrors(reports)
+	if errCount > 0 {
+		errs = append(errs, fmt.Errorf("found %d error(s) in zip files", errCount))
+	}
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	return nil
+}
+
+func runUnseal(ctx *cli.Context) error {
+	dirPaths := ctx.Args().Slice()
+	if len(dirPaths) == 0 {
+		return errNoDirs
+	}
+	var errs []error
+	for _, dirPath := range dirPaths {
+		err := unsealDir(dirPath)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	return nil
+}
+
+func runCSVInit(ctx *cli.Context) error {
+	return initCSVFile(ctx.Context, ctx.Path("dir"), ctx.Path("csv"), ctx.Bool("allow-subdirs"))
+}
+
+func runCSVLint(ctx *cli.Context) error {
+	opts, err := parseCSVOptions(ctx)
+	if err != nil {
+		return err
+	}
+	issues, err := lintCSVFile(ctx.Path("dir"), ctx.Path("csv"), opts)
+	if err != nil {
+		return err
+	}
+	err = printLintIssues(os.Stdout, issues, ctx.Bool("json"))
+	if err != nil {
+		return err
+	}
+	errCount := countLintErrors(issues)
+	if errCount > 0 {
+		return fmt.Errorf("found %d error(s) in csv file", errCount)
+	}
+	return nil
+}
+
+func newCSVFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "csv-delimiter",
+			Usage: csvDelimiterFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "filename-col",
+			Usage: filenameColFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "password-col",
+			Usage: passwordColFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "allow-subdirs",
+			Usage: allowSubdirsFlagUsage,
+		},
+	}
+}
+
+func parseCSVOptions(ctx *cli.Context) (csvOptions, error) {
+	delimiter, err := parseCSVDelimiter(ctx.String("csv-delimiter"))
+	if err != nil {
+		return csvOptions{}, err
+	}
+	opts := csvOptions{
+		delimiter:    delimiter,
+		filenameCol:  ctx.String("filename-col"),
+		passwordCol:  ctx.String("password-col"),
+		allowSubdirs: ctx.Bool("allow-subdirs"),
+	}
+	return opts, nil
+}
+
+func newUnzipFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: includeFlagUsage,
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: excludeFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "min-size",
+			Usage: minSizeFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "max-size",
+			Usage: maxSizeFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "modified-after",
+			Usage: modifiedAfterFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "modified-before",
+			Usage: modifiedBeforeFlagUsage,
+		},
+		&cli.IntFlag{
+			Name:  "recursive-archives",
+			Usage: recursiveArchivesFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "name-encoding",
+			Usage: nameEncodingFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "windows-paths",
+			Usage: windowsPathsFlagUsage,
+			Value: windowsPathsReject,
+		},
+		&cli.StringFlag{
+			Name:  "insecure-entries",
+			Usage: insecureEntriesFlagUsage,
+			Value: insecureEntriesReject,
+		},
+		&cli.BoolFlag{
+			Name:  "portable-names",
+			Usage: portableNamesFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "symlinks",
+			Usage: symlinksFlagUsage,
+			Value: symlinksFile,
+		},
+		&cli.StringFlag{
+			Name:  "mode-policy",
+			Usage: modePolicyFlagUsage,
+			Value: modePolicyPreserveSafe,
+		},
+		&cli.StringFlag{
+			Name:  "file-mode",
+			Usage: fileModeFlagUsage,
+		},
+		&cli.StringFlag{
+			Name:  "dir-mode",
+			Usage: dirModeFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "restore-owner",
+			Usage: restoreOwnerFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "seal",
+			Usage: sealFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "xattrs",
+			Usage: xattrsFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "progress",
+			Usage: progressFlagUsage,
+		},
+		&cli.BoolFlag{
+			Name:  "recover",
+			Usage: recoverFlagUsage,
+		},
+	}
+}
+
+func parseUnzipOptions(ctx *cli.Context) (unzipOptions, error) {
+	filter, err := newEntryFilter(
+		ctx.StringSlice("include"),
+		ctx.StringSlice("exclude"),
+		ctx.String("min-size"),
+		ctx.String("max-size"),
+		ctx.String("modified-after"),
+		ctx.String("modified-before"),
+	)
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	recursiveDepth := ctx.Int("recursive-archives")
+	if recursiveDepth < 0 {
+		return unzipOptions{}, errNegativeRecursiveDepth
+	}
+	nameEncoding, err := parseNameEncoding(ctx.String("name-encoding"))
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	windowsPaths := ctx.String("windows-paths")
+	err = validateWindowsPathsMode(windowsPaths)
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	insecureEntries := ctx.String("insecure-entries")
+	err = validateInsecureEntriesMode(insecureEntries)
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	symlinks := ctx.String("symlinks")
+	err = validateSymlinksMode(symlinks)
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	modes, err := newModePolicy(ctx.String("mode-policy"), ctx.String("file-mode"), ctx.String("dir-mode"), ctx.Bool("restore-owner"))
+	if err != nil {
+		return unzipOptions{}, err
+	}
+	opts := unzipOptions{
+		filter:          filter,
+		recursiveDepth:  recursiveDepth,
+		nameEncoding:    nameEncoding,
+		windowsPaths:    windowsPaths,
+		insecureEntries: insecureEntries,
+		portableNames:   ctx.Bool("portable-names"),
+		symlinks:        symlinks,
+		modes:           modes,
+		seal:            ctx.Bool("seal"),
+		xattrs:          ctx.Bool("xattrs"),
+		progress:        ctx.Bool("progress"),
+		recover:         ctx.Bool("recover"),
+	}
+	return opts, nil
+}
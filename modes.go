@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	modePolicyPreserveSafe = "preserve-safe"
+	modePolicyUmask        = "umask"
+	modePolicyFixed        = "fixed"
+
+	defaultFileMode = 0644 // 0644: rw-r--r--
+	defaultDirMode  = 0755 // 0755: rwxr-xr-x
+
+	unixOwnerExtraID  = 0x7875
+	unixOwnerExtraVer = 1
+)
+
+var (
+	errInvalidModePolicy = errors.New("invalid mode policy. valid policies are preserve-safe, umask and fixed")
+	errModesWithoutFixed = errors.New("file and dir modes can only be used with the fixed mode policy")
+)
+
+type modePolicy struct {
+	policy       string
+	fileMode     os.FileMode
+	dirMode      os.FileMode
+	restoreOwner bool
+}
+
+func newModePolicy(policy string, fileMode string, dirMode string, restoreOwner bool) (modePolicy, error) {
+	switch policy {
+	case modePolicyPreserveSafe, modePolicyUmask:
+		if len(fileMode) > 0 || len(dirMode) > 0 {
+			return modePolicy{}, errModesWithoutFixed
+		}
+	case modePolicyFixed:
+	default:
+		return modePolicy{}, errInvalidModePolicy
+	}
+	modes := modePolicy{
+		policy:       policy,
+		restoreOwner: restoreOwner,
+	}
+	var err error
+	modes.fileMode, err = parseFileMode(fileMode, defaultFileMode)
+	if err != nil {
+		return modePolicy{}, err
+	}
+	modes.dirMode, err = parseFileMode(dirMode, defaultDirMode)
+	if err != nil {
+		return modePolicy{}, err
+	}
+	// the execute bits are given along with the read bits, so the dirs are
+	// always traversable.
+	modes.dirMode |= (modes.dirMode & 0444) >> 2
+	return modes, nil
+}
+
+func parseFileMode(value string, defaultMode os.FileMode) (os.FileMode, error) {
+	if len(value) == 0 {
+		return defaultMode, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode '%s'. use an octal mode such as 0644", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// entryFileMode never includes the setuid, setgid and sticky bits.
+func (p modePolicy) entryFileMode(zipEntry *zip.File) os.FileMode {
+	switch p.policy {
+	case modePolicyUmask:
+		return 0666 // 0666: rw-rw-rw-
+	case modePolicyFixed:
+		return p.fileMode
+	}
+	return zipEntry.Mode().Perm()
+}
+
+// entryDirMode gives the execute bits along with the read bits, so the dirs
+// are always traversable. The zip entry is nil for the parent dirs without an
+// entry.
+func (p modePolicy) entryDirMode(zipEntry *zip.File) os.FileMode {
+	switch p.policy {
+	case modePolicyUmask:
+		return 0777 // 0777: rwxrwxrwx
+	case modePolicyFixed:
+		// the exact mode is set after unzipping, since the dir may not be
+		// writable with it.
+		return p.dirMode | 0700 // 0700: rwx------
+	}
+	if zipEntry == nil {
+		return defaultDirMode
+	}
+	mode := zipEntry.Mode().Perm() | 0700 // 0700: rwx------
+	return mode | (mode&0444)>>2
+}
+
+// applyEntryMode sets the exact file modes for the fixed policy, since the
+// modes given on creation are masked by the umask.
+func (p modePolicy) applyEntryMode(root *os.Root, name string, zipEntry *zip.File) error {
+	if p.policy == modePolicyFixed && !isSymlink(zipEntry) && !zipEntry.FileInfo().IsDir() {
+		err := root.Chmod(name, p.fileMode)
+		if err != nil {
+			return fmt.Errorf("failed to set mode of '%s': %w", name, err)
+		}
+	}
+	if p.restoreOwner && os.Geteuid() == 0 {
+		uid, gid, ok := findUnixOwner(&zipEntry.FileHeader)
+		if !ok {
+			return nil
+		}
+		err := root.Lchown(name, uid, gid)
+		if err != nil {
+			return fmt.Errorf("failed to set owner of '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+func findUnixOwner(header *zip.FileHeader) (int, int, bool) {
+	data, ok := findExtraField(header.Extra, unixOwnerExtraID)
+	if !ok || len(data) < 1 || data[0] != unixOwnerExtraVer {
+		return 0, 0, false
+	}
+	uid, data, ok := readUnixOwnerID(data[1:])
+	if !ok {
+		return 0, 0, false
+	}
+	gid, _, ok := readUnixOwnerID(data)
+	if !ok {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+// readUnixOwnerID reads a little endian id prefixed with its size.
+func readUnixOwnerID(data []byte) (int, []byte, bool) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return 0, nil, false
+	}
+	size := int(data[0])
+	id := uint64(0)
+	for i := size; i > 0; i-- {
+		id = id<<8 | uint64(data[i])
+		if id > math.MaxInt32 {
+			return 0, nil, false
+		}
+	}
+	return int(id), data[1+size:], true
+}
+
+// applyDirModes sets the exact dir modes for the fixed policy. The dirs are
+// changed from the deepest one, so listing them doesn't depend on the new
+// modes.
+func (p modePolicy) applyDirModes(root *os.Root) error {
+	if p.policy != modePolicyFixed {
+		return nil
+	}
+	entries, err := listRootTree(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range slices.Backward(entries) {
+		if !entry.mode.IsDir() || entry.name == "." {
+			continue
+		}
+		err = root.Chmod(entry.name, p.dirMode)
+		if err != nil {
+			return fmt.Errorf("failed to set mode of '%s': %w", filepath.Join(root.Name(), entry.name), err)
+		}
+	}
+	return nil
+}
+
+type treeEntry struct {
+	name string
+	mode fs.FileMode
+}
+
+// listRootTree lists the root and everything in it, with the parent dirs
+// before their content. Symlinks are listed but not followed.
+func listRootTree(root *os.Root) ([]treeEntry, error) {
+	var entries []treeEntry
+	err := fs.WalkDir(root.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, treeEntry{name: filepath.FromSlash(name), mode: info.Mode()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list '%s': %w", root.Name(), err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithModePolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix modes are not supported on windows")
+	}
+	entries := []testZipEntry{
+		{name: "dir_1/"},
+		{name: "dir_1/file_1.txt", content: "content_1", mode: os.ModeSetuid | 0755},
+		{name: "dir_2/dir_3/file_2.txt", content: "content_2"},
+	}
+	tests := []struct {
+		name     string
+		modes    modePolicy
+		expected map[string]os.FileMode
+	}{
+		{
+			name:  "with preserve-safe",
+			modes: modePolicy{policy: modePolicyPreserveSafe},
+			expected: map[string]os.FileMode{
+				"dir_1":                  os.ModeDir | 0755,
+				"dir_1/file_1.txt":       0755,
+				"dir_2":                  os.ModeDir | 0755,
+				"dir_2/dir_3":            os.ModeDir | 0755,
+				"dir_2/dir_3/file_2.txt": 0644,
+			},
+		},
+		{
+			name:  "with fixed",
+			modes: modePolicy{policy: modePolicyFixed, fileMode: 0400, dirMode: 0500},
+			expected: map[string]os.FileMode{
+				"dir_1":                  os.ModeDir | 0500,
+				"dir_1/file_1.txt":       0400,
+				"dir_2":                  os.ModeDir | 0500,
+				"dir_2/dir_3":            os.ModeDir | 0500,
+				"dir_2/dir_3/file_2.txt": 0400,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, "")
+			opts := unzipOptions{
+				modes: tt.modes,
+			}
+			err := unzipFile(context.Background(), filePath, "", opts)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = filepath.WalkDir(makeDirPath(filePath), func(path string, entry os.DirEntry, err error) error {
+					if err == nil && entry.IsDir() {
+						_ = os.Chmod(path, 0755)
+					}
+					return nil
+				})
+			})
+			for name, expected := range tt.expected {
+				info, err := os.Stat(filepath.Join(makeDirPath(filePath), name))
+				require.NoError(t, err)
+				require.Equal(t, expected, info.Mode(), name)
+			}
+		})
+	}
+}
+
+func TestNewModePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		fileMode  string
+		dirMode   string
+		expected  modePolicy
+		expectErr bool
+	}{
+		{
+			name:     "with preserve-safe",
+			policy:   modePolicyPreserveSafe,
+			expected: modePolicy{policy: modePolicyPreserveSafe, fileMode: 0644, dirMode: 0755},
+		},
+		{
+			name:     "with fixed",
+			policy:   modePolicyFixed,
+			fileMode: "600",
+			dirMode:  "0700",
+			expected: modePolicy{policy: modePolicyFixed, fileMode: 0600, dirMode: 0700},
+		},
+		{
+			name:     "with a dir mode without execute bits",
+			policy:   modePolicyFixed,
+			dirMode:  "0640",
+			expected: modePolicy{policy: modePolicyFixed, fileMode: 0644, dirMode: 0750},
+		},
+		{
+			name:      "with modes without fixed",
+			policy:    modePolicyUmask,
+			fileMode:  "0600",
+			expectErr: true,
+		},
+		{
+			name:      "with an invalid mode",
+			policy:    modePolicyFixed,
+			fileMode:  "0999",
+			expectErr: true,
+		},
+		{
+			name:      "with a special mode",
+			policy:    modePolicyFixed,
+			fileMode:  "4755",
+			expectErr: true,
+		},
+		{
+			name:      "with an invalid policy",
+			policy:    "preserve",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := newModePolicy(tt.policy, tt.fileMode, tt.dirMode, false)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestModePolicyEntryModes(t *testing.T) {
+	newEntry := func(name string, mode os.FileMode) *zip.File {
+		file := &zip.File{FileHeader: zip.FileHeader{Name: name}}
+		file.SetMode(mode)
+		return file
+	}
+	setuidFile := newEntry("file_1", os.ModeSetuid|os.ModeSetgid|0750)
+	readOnlyDir := newEntry("dir_1/", os.ModeDir|0444)
+	privateDir := newEntry("dir_2/", os.ModeDir|0600)
+
+	modes := modePolicy{policy: modePolicyPreserveSafe}
+	require.Equal(t, os.FileMode(0750), modes.entryFileMode(setuidFile))
+	require.Equal(t, os.FileMode(0755), modes.entryDirMode(readOnlyDir))
+	require.Equal(t, os.FileMode(0700), modes.entryDirMode(privateDir))
+	require.Equal(t, os.FileMode(0755), modes.entryDirMode(nil))
+
+	modes = modePolicy{policy: modePolicyUmask}
+	require.Equal(t, os.FileMode(0666), modes.entryFileMode(setuidFile))
+	require.Equal(t, os.FileMode(0777), modes.entryDirMode(readOnlyDir))
+}
+
+func TestFindUnixOwner(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       []byte
+		expectedUID int
+		expectedGID int
+		expectOK    bool
+	}{
+		{
+			name:        "with 4 byte ids",
+			extra:       []byte{0x75, 0x78, 11, 0, 1, 4, 0xE8, 0x03, 0, 0, 4, 0xE9, 0x03, 0, 0},
+			expectedUID: 1000,
+			expectedGID: 1001,
+			expectOK:    true,
+		},
+		{
+			name:        "with 1 byte ids",
+			extra:       []byte{0x75, 0x78, 5, 0, 1, 1, 0, 1, 0},
+			expectedUID: 0,
+			expectedGID: 0,
+			expectOK:    true,
+		},
+		{
+			name:  "with a too large id",
+			extra: []byte{0x75, 0x78, 11, 0, 1, 4, 0, 0, 0, 0x80, 4, 0, 0, 0, 0},
+		},
+		{
+			name:  "with a truncated field",
+			extra: []byte{0x75, 0x78, 3, 0, 1, 4, 0xE8},
+		},
+		{
+			name:  "without the field",
+			extra: []byte{0x55, 0x54, 1, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, gid, ok := findUnixOwner(&zip.FileHeader{Extra: tt.extra})
+			require.Equal(t, tt.expectOK, ok)
+			require.Equal(t, tt.expectedUID, uid)
+			require.Equal(t, tt.expectedGID, gid)
+		})
+	}
+}
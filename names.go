@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+const (
+	utf8NameFlag          = 0x800
+	unicodePathExtraID    = 0x7075
+	unicodePathExtraVer   = 1
+	unicodePathHeaderSize = 5
+)
+
+var nameEncodings = map[string]encoding.Encoding{
+	"cp437":     charmap.CodePage437,
+	"cp850":     charmap.CodePage850,
+	"cp852":     charmap.CodePage852,
+	"cp866":     charmap.CodePage866,
+	"cp1250":    charmap.Windows1250,
+	"cp1251":    charmap.Windows1251,
+	"cp1252":    charmap.Windows1252,
+	"cp1253":    charmap.Windows1253,
+	"cp1254":    charmap.Windows1254,
+	"shift_jis": japanese.ShiftJIS,
+	"euc-kr":    korean.EUCKR,
+	"gbk":       simplifiedchinese.GBK,
+	"big5":      traditionalchinese.Big5,
+}
+
+type decodedName struct {
+	raw     string
+	decoded string
+}
+
+func parseNameEncoding(value string) (encoding.Encoding, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	enc, ok := nameEncodings[strings.ToLower(value)]
+	if !ok {
+		names := make([]string, 0, len(nameEncodings))
+		for name := range nameEncodings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid name encoding '%s'. use one of: %s", value, strings.Join(names, ", "))
+	}
+	return enc, nil
+}
+
+// decodeEntryNames replaces the names of the entries without the utf-8 flag
+// with their unicode path extra field, or decodes them with the given
+// encoding if there is no such field.
+func decodeEntryNames(files []*zip.File, enc encoding.Encoding) ([]decodedName, error) {
+	var decodedNames []decodedName
+	for _, file := range files {
+		if file.Flags&utf8NameFlag != 0 {
+			continue
+		}
+		name, ok := findUnicodePath(&file.FileHeader)
+		if !ok {
+			if enc == nil {
+				continue
+			}
+			var err error
+			name, err = enc.NewDecoder().String(file.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode zip entry name %q: %w", file.Name, err)
+			}
+		}
+		if name == file.Name {
+			continue
+		}
+		decodedNames = append(decodedNames, decodedName{raw: file.Name, decoded: name})
+		file.Name = name
+	}
+	return decodedNames, nil
+}
+
+func findUnicodePath(header *zip.FileHeader) (string, bool) {
+	data, ok := findExtraField(header.Extra, unicodePathExtraID)
+	if !ok || len(data) < unicodePathHeaderSize || data[0] != unicodePathExtraVer {
+		return "", false
+	}
+	// the field is stale if the name was changed after it was written
+	if binary.LittleEndian.Uint32(data[1:]) != crc32.ChecksumIEEE([]byte(header.Name)) {
+		return "", false
+	}
+	name := string(data[unicodePathHeaderSize:])
+	if !utf8.ValidString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func findExtraField(extra []byte, id uint16) ([]byte, bool) {
+	for len(extra) >= 4 {
+		fieldID := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if fieldID == id {
+			return extra[:size], true
+		}
+		extra = extra[size:]
+	}
+	return nil, false
+}
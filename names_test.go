@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestUnzipFileWithNameEncoding(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "\x80a.txt", content: "content_1"},
+		{name: "dir_1/\x87b.txt", content: "content_2"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	opts := unzipOptions{
+		nameEncoding: charmap.CodePage437,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	expected := map[string]string{
+		"Ça.txt":       "content_1",
+		"dir_1/çb.txt": "content_2",
+	}
+	requireDirContent(t, makeDirPath(filePath), expected)
+	require.NoFileExists(t, filepath.Join(makeDirPath(filePath), "\x80a.txt"))
+}
+
+func TestDecodeEntryNames(t *testing.T) {
+	rawName := "\x8E\x99.txt"
+	tests := []struct {
+		name     string
+		header   zip.FileHeader
+		expected []decodedName
+	}{
+		{
+			name:     "with a utf-8 flag",
+			header:   zip.FileHeader{Name: rawName, Flags: utf8NameFlag},
+			expected: nil,
+		},
+		{
+			name:     "with an ascii name",
+			header:   zip.FileHeader{Name: "file_1.txt"},
+			expected: nil,
+		},
+		{
+			name:     "with a legacy name",
+			header:   zip.FileHeader{Name: rawName},
+			expected: []decodedName{{raw: rawName, decoded: "ÄÖ.txt"}},
+		},
+		{
+			name:     "with a unicode path extra field",
+			header:   zip.FileHeader{Name: rawName, Extra: makeUnicodePathExtra(rawName, "ÅÆ.txt")},
+			expected: []decodedName{{raw: rawName, decoded: "ÅÆ.txt"}},
+		},
+		{
+			name:     "with a stale unicode path extra field",
+			header:   zip.FileHeader{Name: rawName, Extra: makeUnicodePathExtra("other.txt", "ÅÆ.txt")},
+			expected: []decodedName{{raw: rawName, decoded: "ÄÖ.txt"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []*zip.File{{FileHeader: tt.header}}
+			actual, err := decodeEntryNames(files, charmap.CodePage437)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+			if len(tt.expected) > 0 {
+				require.Equal(t, tt.expected[0].decoded, files[0].Name)
+			}
+		})
+	}
+}
+
+func TestDecodeEntryNamesWithoutEncoding(t *testing.T) {
+	files := []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "\x8E.txt"}},
+		{FileHeader: zip.FileHeader{Name: "\x99.txt", Extra: makeUnicodePathExtra("\x99.txt", "Ö.txt")}},
+	}
+	actual, err := decodeEntryNames(files, nil)
+	require.NoError(t, err)
+	require.Equal(t, []decodedName{{raw: "\x99.txt", decoded: "Ö.txt"}}, actual)
+	require.Equal(t, "\x8E.txt", files[0].Name)
+}
+
+func TestParseNameEncoding(t *testing.T) {
+	enc, err := parseNameEncoding("")
+	require.NoError(t, err)
+	require.Nil(t, enc)
+
+	enc, err = parseNameEncoding("CP866")
+	require.NoError(t, err)
+	require.Equal(t, charmap.CodePage866, enc)
+
+	_, err = parseNameEncoding("cp999")
+	require.Error(t, err)
+}
+
+func makeUnicodePathExtra(rawName string, name string) []byte {
+	extra := binary.LittleEndian.AppendUint16(nil, unicodePathExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(unicodePathHeaderSize+len(name)))
+	extra = append(extra, unicodePathExtraVer)
+	extra = binary.LittleEndian.AppendUint32(extra, crc32.ChecksumIEEE([]byte(rawName)))
+	return append(extra, name...)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	archiveTypeNone = iota
+	archiveTypeZip
+	archiveTypeGzip
+)
+
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1F, 0x8B}
+
+	errMaxSizeExceeded = errors.New("max size exceeded")
+)
+
+// unzipNestedArchives unzips the nested archives and returns the number of
+// gzip files filtered out by the max size, which are skipped like the entries
+// larger than it.
+func unzipNestedArchives(ctx context.Context, root *os.Root, names []string, password string, opts unzipOptions) (int, []error) {
+	if opts.recursiveDepth <= 0 {
+		return 0, nil
+	}
+	nestedOpts := opts
+	nestedOpts.recursiveDepth--
+	var filtered int
+	var errs []error
+	for _, name := range names {
+		archiveType, err := detectArchiveType(root, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		switch archiveType {
+		case archiveTypeZip:
+			err = unzipNestedFile(ctx, root, name, password, nestedOpts)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case archiveTypeGzip:
+			dstName, err := gunzipFile(ctx, root, name, opts)
+			if errors.Is(err, errMaxSizeExceeded) {
+				filtered++
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			nestedFiltered, nestedErrs := unzipNestedArchives(ctx, root, []string{dstName}, password, nestedOpts)
+			filtered += nestedFiltered
+			errs = append(errs, nestedErrs...)
+		}
+	}
+	return filtered, errs
+}
+
+// unzipNestedFile unzips a nested archive from the handle opened through the
+// root, so a symlink planted in its place can't redirect the read.
+func unzipNestedFile(ctx context.Context, root *os.Root, name string, password string, opts unzipOptions) error {
+	path := filepath.Join(root.Name(), name)
+	file, err := root.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open file '%s': %w", path, err)
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to get file info for '%s': %w", path, err)
+	}
+
+	dirName := makeDirPath(name)
+	dirPath := filepath.Join(root.Name(), dirName)
+	err = root.MkdirAll(dirName, 0755) // 0755: rwxr-xr-x
+	if err != nil {
+		return fmt.Errorf("failed to create dir '%s': %w", dirPath, err)
+	}
+	nestedRoot, err := root.OpenRoot(dirName)
+	if err != nil {
+		return fmt.Errorf("failed to open dir '%s': %w", dirPath, err)
+	}
+	defer nestedRoot.Close()
+	source := zipSource{
+		name:   path,
+		reader: file,
+		size:   fileInfo.Size(),
+	}
+	report, err := unzipFileToRoot(ctx, source, nestedRoot, password, opts)
+	opts.logReport(report)
+	return err
+}
+
+func detectArchiveType(root *os.Root, name string) (int, error) {
+	path := filepath.Join(root.Name(), name)
+	file, err := root.Open(name)
+	if err != nil {
+		return archiveTypeNone, fmt.Errorf("failed to open file '%s': %w", path, err)
+	}
+	defer file.Close()
+	magic := make([]byte, len(zipMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return archiveTypeNone, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, zipMagic), bytes.HasPrefix(magic, emptyZipMagic):
+		return archiveTypeZip, nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return archiveTypeGzip, nil
+	}
+	return archiveTypeNone, nil
+}
+
+func gunzipFile(ctx context.Context, root *os.Root, name string, opts unzipOptions) (string, error) {
+	path := filepath.Join(root.Name(), name)
+	dstName := makeGunzipPath(name)
+	dstPath := filepath.Join(root.Name(), dstName)
+	opts.logf("gunzipping %s...\n", path)
+
+	srcFile, err := root.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file '%s': %w", path, err)
+	}
+	defer srcFile.Close()
+	gzipReader, err := gzip.NewReader(bufio.NewReaderSize(srcFile, defaultBufSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to open gzip file '%s': %w", path, err)
+	}
+	defer gzipReader.Close()
+
+	dstFile, err := root.OpenFile(dstName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) // 0644: rw-r--r--
+	if err != nil {
+		return "", fmt.Errorf("failed to create dst file '%s': %w", dstPath, err)
+	}
+	dstWriter := bufio.NewWriterSize(dstFile, defaultBufSize)
+
+	err = copyWithMaxSize(dstWriter, newContextReader(ctx, gzipReader), opts.filter.maxSize)
+	if err == nil {
+		err = dstWriter.Flush()
+	}
+	if err != nil {
+		_ = dstFile.Close()
+		_ = root.Remove(dstName)
+		return "", fmt.Errorf("failed to gunzip file '%s' to dst file '%s': %w", path, dstPath, err)
+	}
+	err = dstFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to close destination file '%s': %w", dstPath, err)
+	}
+	return dstName, nil
+}
+
+func copyWithMaxSize(w io.Writer, r io.Reader, maxSize int64) error {
+	if maxSize <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if n > maxSize {
+		return errMaxSizeExceeded
+	}
+	return nil
+}
+
+func makeGunzipPath(path string) string {
+	ext := filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".gz", ".gzip":
+		return path[:len(path)-len(ext)]
+	case ".tgz":
+		return path[:len(path)-len(ext)] + ".tar"
+	}
+	return path + "_gunzipped"
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithNestedArchives(t *testing.T) {
+	innerZipFilePath := createTestZipFile(t, []testZipEntry{{name: "inner.txt", content: "inner"}}, "")
+	innerZipContent, err := os.ReadFile(innerZipFilePath)
+	require.NoError(t, err)
+
+	var gzipContent bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipContent)
+	_, err = gzipWriter.Write(innerZipContent)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	entries := []testZipEntry{
+		{name: "outer.txt", content: "outer"},
+		{name: "nested/inner.zip", content: string(innerZipContent)},
+		{name: "nested/other.zip.gz", content: gzipContent.String()},
+	}
+
+	tests := []struct {
+		name     string
+		depth    int
+		expected []string
+	}{
+		{
+			name:     "without recursion",
+			depth:    0,
+			expected: []string{"outer.txt", "nested/inner.zip", "nested/other.zip.gz"},
+		},
+		{
+			name:     "with depth 1",
+			depth:    1,
+			expected: []string{"outer.txt", "nested/inner.zip", "nested/other.zip.gz", "nested/inner/inner.txt", "nested/other.zip"},
+		},
+		{
+			name:     "with depth 2",
+			depth:    2,
+			expected: []string{"outer.txt", "nested/inner.zip", "nested/other.zip.gz", "nested/inner/inner.txt", "nested/other/inner.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, "password_1")
+			opts := unzipOptions{
+				recursiveDepth: tt.depth,
+			}
+			err := unzipFile(context.Background(), filePath, "password_1", opts)
+			require.NoError(t, err)
+			dirPath := makeDirPath(filePath)
+			for _, name := range tt.expected {
+				require.FileExists(t, filepath.Join(dirPath, name))
+			}
+			if tt.depth == 0 {
+				require.NoDirExists(t, filepath.Join(dirPath, "nested", "inner"))
+			}
+			if tt.depth == 1 {
+				require.NoDirExists(t, filepath.Join(dirPath, "nested", "other"))
+			}
+		})
+	}
+}
+
+func TestUnzipFileWithLargeNestedGzipFile(t *testing.T) {
+	var gzipContent bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipContent)
+	_, err := gzipWriter.Write(bytes.Repeat([]byte("a"), 10000))
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+
+	entries := []testZipEntry{
+		{name: "outer.txt", content: "outer"},
+		{name: "nested/large.log.gz", content: gzipContent.String()},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		filter:         entryFilter{maxSize: 1000},
+		recursiveDepth: 1,
+		logWriter:      &logs,
+	}
+	err = unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	requireDirContent(t, makeDirPath(filePath), map[string]string{
+		"outer.txt":           "outer",
+		"nested/large.log.gz": gzipContent.String(),
+	})
+	require.Contains(t, logs.String(), "2 entries extracted, 1 filtered out")
+}
+
+func TestDetectArchiveType(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		expected int
+	}{
+		{
+			name:     "with a zip file",
+			content:  []byte("PK\x03\x04rest"),
+			expected: archiveTypeZip,
+		},
+		{
+			name:     "with an empty zip file",
+			content:  []byte("PK\x05\x06rest"),
+			expected: archiveTypeZip,
+		},
+		{
+			name:     "with a gzip file",
+			content:  []byte{0x1F, 0x8B, 0x08, 0x00},
+			expected: archiveTypeGzip,
+		},
+		{
+			name:     "with a text file",
+			content:  []byte("text"),
+			expected: archiveTypeNone,
+		},
+		{
+			name:     "with an empty file",
+			content:  nil,
+			expected: archiveTypeNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dirPath := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dirPath, "test"), tt.content, 0644))
+			root, err := os.OpenRoot(dirPath)
+			require.NoError(t, err)
+			defer root.Close()
+
+			actual, err := detectArchiveType(root, "test")
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCopyWithMaxSize(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, copyWithMaxSize(&buf, bytes.NewReader([]byte("test")), 0))
+	require.NoError(t, copyWithMaxSize(&buf, bytes.NewReader([]byte("test")), 4))
+	require.ErrorIs(t, copyWithMaxSize(&buf, bytes.NewReader([]byte("test")), 3), errMaxSizeExceeded)
+}
+
+func TestMakeGunzipPath(t *testing.T) {
+	require.Equal(t, "/tmp/file_1.log", makeGunzipPath("/tmp/file_1.log.gz"))
+	require.Equal(t, "/tmp/file_1.tar", makeGunzipPath("/tmp/file_1.tgz"))
+	require.Equal(t, "/tmp/file_1_gunzipped", makeGunzipPath("/tmp/file_1"))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	windowsPathsReject    = "reject"
+	windowsPathsNormalize = "normalize"
+
+	insecureEntriesReject   = "reject"
+	insecureEntriesSkip     = "skip"
+	insecureEntriesSanitize = "sanitize"
+
+	insecureDirName      = "_insecure"
+	insecureMappingPath  = insecureDirName + "/mapping.csv"
+	entryNameColName     = "Entry Name"
+	sanitizedNameColName = "Sanitized Name"
+)
+
+var (
+	errInvalidWindowsPathsMode    = errors.New("invalid windows paths mode. valid modes are reject and normalize")
+	errInvalidInsecureEntriesMode = errors.New("invalid insecure entries mode. valid modes are reject, skip and sanitize")
+)
+
+type sanitizedName struct {
+	raw       string
+	sanitized string
+}
+
+func validateWindowsPathsMode(mode string) error {
+	switch mode {
+	case windowsPathsReject, windowsPathsNormalize:
+		return nil
+	}
+	return errInvalidWindowsPathsMode
+}
+
+func validateInsecureEntriesMode(mode string) error {
+	switch mode {
+	case insecureEntriesReject, insecureEntriesSkip, insecureEntriesSanitize:
+		return nil
+	}
+	return errInvalidInsecureEntriesMode
+}
+
+func normalizeWindowsPaths(files []*zip.File) {
+	for _, file := range files {
+		file.Name = normalizeWindowsPath(file.Name)
+	}
+}
+
+// normalizeWindowsPath converts the separators to slashes and maps a drive
+// letter prefix to a top-level dir, e.g. C:\Windows to C/Windows. The result
+// still goes through the insecure path checks.
+func normalizeWindowsPath(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if !hasDrivePrefix(name) {
+		return name
+	}
+	drive := strings.ToUpper(name[:1])
+	return drive + "/" + strings.TrimLeft(name[2:], "/")
+}
+
+func hasDrivePrefix(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && isASCIILetter(name[0])
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isInsecurePath(name string) bool {
+	return !filepath.IsLocal(name) || strings.Contains(name, `\`) || hasDrivePrefix(name)
+}
+
+func skipInsecurePaths(files []*zip.File) ([]*zip.File, []string) {
+	secureFiles := make([]*zip.File, 0, len(files))
+	var skippedNames []string
+	for _, file := range files {
+		if isInsecurePath(file.Name) {
+			skippedNames = append(skippedNames, file.Name)
+			continue
+		}
+		secureFiles = append(secureFiles, file)
+	}
+	return secureFiles, skippedNames
+}
+
+// sanitizeInsecurePaths moves the entries with insecure paths under the
+// insecure dir, keeping the meaningful parts of their paths and making them
+// unique among all entries.
+func sanitizeInsecurePaths(files []*zip.File) []sanitizedName {
+	taken := make(map[string]bool, len(files)+1)
+	for _, file := range files {
+		taken[strings.TrimSuffix(file.Name, "/")] = true
+	}
+	taken[insecureMappingPath] = true
+
+	var sanitizedNames []sanitizedName
+	for _, file := range files {
+		if !isInsecurePath(file.Name) {
+			continue
+		}
+		name := makeSecurePath(file.Name)
+		ext := path.Ext(name)
+		uniqueName := name
+		for i := 2; taken[uniqueName]; i++ {
+			uniqueName = fmt.Sprintf("%s_%d%s", name[:len(name)-len(ext)], i, ext)
+		}
+		taken[uniqueName] = true
+		if file.FileInfo().IsDir() {
+			uniqueName += "/"
+		}
+		sanitizedNames = append(sanitizedNames, sanitizedName{raw: file.Name, sanitized: uniqueName})
+		file.Name = uniqueName
+	}
+	return sanitizedNames
+}
+
+func makeSecurePath(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if hasDrivePrefix(name) {
+		name = name[:1] + "/" + name[2:]
+	}
+	elems := []string{insecureDirName}
+	for _, elem := range strings.Split(name, "/") {
+		switch elem {
+		case "", ".", "..":
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	if len(elems) == 1 {
+		elems = append(elems, "entry")
+	}
+	return path.Join(elems...)
+}
+
+func makeInsecureMapping(sanitizedNames []sanitizedName) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{entryNameColName, sanitizedNameColName})
+	for _, name := range sanitizedNames {
+		_ = writer.Write([]string{name.raw, name.sanitized})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write insecure entry mapping: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeInsecureMapping(root *os.Root, sanitizedNames []sanitizedName) error {
+	data, err := makeInsecureMapping(sanitizedNames)
+	if err != nil {
+		return err
+	}
+	name := filepath.FromSlash(insecureMappingPath)
+	mappingPath := filepath.Join(root.Name(), name)
+	err = root.MkdirAll(filepath.Dir(name), 0755) // 0755: rwxr-xr-x
+	if err != nil {
+		return fmt.Errorf("failed to create dir '%s': %w", filepath.Dir(mappingPath), err)
+	}
+	file, err := root.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) // 0644: rw-r--r--
+	if err != nil {
+		return fmt.Errorf("failed to create insecure entry mapping file '%s': %w", mappingPath, err)
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write insecure entry mapping file '%s': %w", mappingPath, err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close insecure entry mapping file '%s': %w", mappingPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithWindowsPaths(t *testing.T) {
+	entries := []testZipEntry{
+		{name: `C:\Windows\System32\config\SAM`, content: "content_1"},
+		{name: "D:/file_1.txt", content: "content_3"},
+		{name: `Users\user_1\NTUSER.DAT`, content: "content_2"},
+	}
+	tests := []struct {
+		name         string
+		windowsPaths string
+		expectErr    bool
+	}{
+		{
+			name:         "with reject",
+			windowsPaths: windowsPathsReject,
+			expectErr:    true,
+		},
+		{
+			name:         "with normalize",
+			windowsPaths: windowsPathsNormalize,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, "")
+			opts := unzipOptions{
+				windowsPaths: tt.windowsPaths,
+			}
+			err := unzipFile(context.Background(), filePath, "", opts)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			expected := map[string]string{
+				"C/Windows/System32/config/SAM": "content_1",
+				"Users/user_1/NTUSER.DAT":       "content_2",
+				"D/file_1.txt":                  "content_3",
+			}
+			requireDirContent(t, makeDirPath(filePath), expected)
+		})
+	}
+}
+
+func TestUnzipFileWithWindowsPathTraversal(t *testing.T) {
+	entries := []testZipEntry{
+		{name: `C:\..\..\file_1.txt`, content: "content_1"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	opts := unzipOptions{
+		windowsPaths: windowsPathsNormalize,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.ErrorContains(t, err, "insecure path 'C/../../file_1.txt'")
+}
+
+func TestNormalizeWindowsPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "with a slash path",
+			path:     "dir_1/file_1.txt",
+			expected: "dir_1/file_1.txt",
+		},
+		{
+			name:     "with a backslash path",
+			path:     `dir_1\file_1.txt`,
+			expected: "dir_1/file_1.txt",
+		},
+		{
+			name:     "with a drive letter",
+			path:     `c:\dir_1\file_1.txt`,
+			expected: "C/dir_1/file_1.txt",
+		},
+		{
+			name:     "with a drive relative path",
+			path:     `D:file_1.txt`,
+			expected: "D/file_1.txt",
+		},
+		{
+			name:     "with a drive dir",
+			path:     `C:\`,
+			expected: "C/",
+		},
+		{
+			name:     "with a unc path",
+			path:     `\\server\share\file_1.txt`,
+			expected: "//server/share/file_1.txt",
+		},
+		{
+			name:     "with a traversal",
+			path:     `C:\..\file_1.txt`,
+			expected: "C/../file_1.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, normalizeWindowsPath(tt.path))
+		})
+	}
+}
+
+func TestValidateWindowsPathsMode(t *testing.T) {
+	require.NoError(t, validateWindowsPathsMode(windowsPathsReject))
+	require.NoError(t, validateWindowsPathsMode(windowsPathsNormalize))
+	require.ErrorIs(t, validateWindowsPathsMode("ignore"), errInvalidWindowsPathsMode)
+}
+
+func TestUnzipFileWithInsecureEntries(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "file_1.txt", content: "content_1"},
+		{name: "../file_2.txt", content: "content_2"},
+		{name: "/etc/file_3.txt", content: "content_3"},
+		{name: `dir_1\..\..\file_2.txt`, content: "content_4"},
+	}
+	tests := []struct {
+		name            string
+		insecureEntries string
+		expected        map[string]string
+		expectErr       bool
+	}{
+		{
+			name:            "with reject",
+			insecureEntries: insecureEntriesReject,
+			expectErr:       true,
+		},
+		{
+			name:            "with skip",
+			insecureEntries: insecureEntriesSkip,
+			expected: map[string]string{
+				"file_1.txt": "content_1",
+			},
+		},
+		{
+			name:            "with sanitize",
+			insecureEntries: insecureEntriesSanitize,
+			expected: map[string]string{
+				"file_1.txt":                 "content_1",
+				"_insecure/file_2.txt":       "content_2",
+				"_insecure/etc/file_3.txt":   "content_3",
+				"_insecure/dir_1/file_2.txt": "content_4",
+				"_insecure/mapping.csv": "Entry Name,Sanitized Name\n" +
+					"../file_2.txt,_insecure/file_2.txt\n" +
+					"/etc/file_3.txt,_insecure/etc/file_3.txt\n" +
+					`dir_1\..\..\file_2.txt,_insecure/dir_1/file_2.txt` + "\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, "")
+			opts := unzipOptions{
+				insecureEntries: tt.insecureEntries,
+			}
+			err := unzipFile(context.Background(), filePath, "", opts)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			requireDirContent(t, makeDirPath(filePath), tt.expected)
+			require.NoFileExists(t, filepath.Join(filepath.Dir(filePath), "file_2.txt"))
+		})
+	}
+}
+
+func TestSanitizeInsecurePaths(t *testing.T) {
+	files := []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "_insecure/file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "../file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "/file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "../"}},
+		{FileHeader: zip.FileHeader{Name: `C:\dir_1\`}},
+		{FileHeader: zip.FileHeader{Name: "file_2.txt"}},
+	}
+	expected := []sanitizedName{
+		{raw: "../file_1.txt", sanitized: "_insecure/file_1_2.txt"},
+		{raw: "/file_1.txt", sanitized: "_insecure/file_1_3.txt"},
+		{raw: "../", sanitized: "_insecure/entry/"},
+		{raw: `C:\dir_1\`, sanitized: "_insecure/C/dir_1"},
+	}
+	actual := sanitizeInsecurePaths(files)
+	require.Equal(t, expected, actual)
+	require.Equal(t, "file_2.txt", files[5].Name)
+	require.Equal(t, "_insecure/entry/", files[3].Name)
+}
+
+func TestValidateInsecureEntriesMode(t *testing.T) {
+	require.NoError(t, validateInsecureEntriesMode(insecureEntriesReject))
+	require.NoError(t, validateInsecureEntriesMode(insecureEntriesSkip))
+	require.NoError(t, validateInsecureEntriesMode(insecureEntriesSanitize))
+	require.ErrorIs(t, validateInsecureEntriesMode("ignore"), errInvalidInsecureEntriesMode)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const nonPortableChars = `<>:"|?*`
+
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// portablePath is a path given to the entries, keyed by its lower case form.
+type portablePath struct {
+	path  string
+	raw   string
+	isDir bool
+}
+
+// portableNamer makes the portable names of the entries, remembering the paths
+// given to their dirs and files. The original names are reserved, so a unique
+// name made for one entry isn't given to another entry by its own name.
+type portableNamer struct {
+	seen     map[string]portablePath
+	dirs     map[string]string
+	reserved map[string]bool
+}
+
+// makePortableNames renames the entries so they can be created on windows
+// file systems. Names differing only in case are merged for dirs and made
+// unique for files, since those file systems are case insensitive. A dir is
+// never merged with a file.
+func makePortableNames(files []*zip.File) []sanitizedName {
+	namer := portableNamer{
+		seen:     make(map[string]portablePath, len(files)),
+		dirs:     make(map[string]string),
+		reserved: make(map[string]bool, len(files)),
+	}
+	for _, file := range files {
+		elems := strings.Split(strings.TrimSuffix(file.Name, "/"), "/")
+		for i := range elems {
+			namer.reserved[strings.ToLower(path.Join(elems[:i+1]...))] = true
+		}
+	}
+	var renamedNames []sanitizedName
+	for _, file := range files {
+		name := namer.makePortablePath(file.Name)
+		if name == file.Name {
+			continue
+		}
+		renamedNames = append(renamedNames, sanitizedName{raw: file.Name, sanitized: name})
+		file.Name = name
+	}
+	return renamedNames
+}
+
+func (n *portableNamer) makePortablePath(name string) string {
+	isDir := strings.HasSuffix(name, "/")
+	elems := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	parent := ""
+	for i, elem := range elems {
+		raw := path.Join(elems[:i+1]...)
+		elemIsDir := isDir || i < len(elems)-1
+		if dirPath, ok := n.dirs[raw]; ok && elemIsDir {
+			parent = dirPath
+			continue
+		}
+		elemPath := path.Join(parent, makePortableElem(elem))
+		existing, ok := n.seen[strings.ToLower(elemPath)]
+		switch {
+		case ok && elemIsDir && existing.isDir:
+			elemPath = existing.path
+		case ok && (elemIsDir || existing.isDir || existing.raw != raw):
+			elemPath = n.makeUniquePortablePath(elemPath)
+		case !ok && strings.ToLower(elemPath) != strings.ToLower(raw) && n.reserved[strings.ToLower(elemPath)]:
+			elemPath = n.makeUniquePortablePath(elemPath)
+		}
+		if _, ok := n.seen[strings.ToLower(elemPath)]; !ok {
+			n.seen[strings.ToLower(elemPath)] = portablePath{path: elemPath, raw: raw, isDir: elemIsDir}
+		}
+		if elemIsDir {
+			n.dirs[raw] = elemPath
+		}
+		parent = elemPath
+	}
+	if isDir {
+		return parent + "/"
+	}
+	return parent
+}
+
+func (n *portableNamer) makeUniquePortablePath(elemPath string) string {
+	ext := path.Ext(elemPath)
+	for i := 2; ; i++ {
+		uniquePath := fmt.Sprintf("%s_%d%s", elemPath[:len(elemPath)-len(ext)], i, ext)
+		if _, ok := n.seen[strings.ToLower(uniquePath)]; !ok && !n.reserved[strings.ToLower(uniquePath)] {
+			return uniquePath
+		}
+	}
+}
+
+func makePortableElem(elem string) string {
+	var builder strings.Builder
+	for _, r := range elem {
+		if r < 0x20 || strings.ContainsRune(nonPortableChars, r) {
+			builder.WriteRune('_')
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	elem = builder.String()
+
+	trimmed := strings.TrimRight(elem, ". ")
+	elem = trimmed + strings.Repeat("_", len(elem)-len(trimmed))
+
+	base, _, _ := strings.Cut(elem, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		elem = "_" + elem
+	}
+	return elem
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithPortableNames(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "dir_1/file:1?.txt", content: "content_1"},
+		{name: "DIR_1/file_2.txt", content: "content_2"},
+		{name: "dir_1/File_2.txt", content: "content_3"},
+		{name: "con.log", content: "content_4"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	opts := unzipOptions{
+		portableNames: true,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	expected := map[string]string{
+		"dir_1/file_1_.txt":  "content_1",
+		"dir_1/file_2.txt":   "content_2",
+		"dir_1/File_2_2.txt": "content_3",
+		"_con.log":           "content_4",
+	}
+	requireDirContent(t, makeDirPath(filePath), expected)
+}
+
+func TestUnzipFileWithPortableNamesAndCollisions(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "X.txt", content: "content_1"},
+		{name: "x.txt", content: "content_2"},
+		{name: "x_2.txt", content: "content_3"},
+		{name: "a", content: "content_4"},
+		{name: "A/"},
+		{name: "A/file_1.txt", content: "content_5"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	opts := unzipOptions{
+		portableNames: true,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	expected := map[string]string{
+		"X.txt":          "content_1",
+		"x_3.txt":        "content_2",
+		"x_2.txt":        "content_3",
+		"a":              "content_4",
+		"A_2/file_1.txt": "content_5",
+	}
+	requireDirContent(t, makeDirPath(filePath), expected)
+}
+
+func TestMakePortableNames(t *testing.T) {
+	files := []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "Dir_1/"}},
+		{FileHeader: zip.FileHeader{Name: "dir_1/file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "DIR_1/FILE_1.TXT"}},
+		{FileHeader: zip.FileHeader{Name: "dir_1/file_1_2.txt"}},
+		{FileHeader: zip.FileHeader{Name: "Dir_1/file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "dir_2/"}},
+	}
+	expected := []sanitizedName{
+		{raw: "dir_1/file_1.txt", sanitized: "Dir_1/file_1.txt"},
+		{raw: "DIR_1/FILE_1.TXT", sanitized: "Dir_1/FILE_1_3.TXT"},
+		{raw: "dir_1/file_1_2.txt", sanitized: "Dir_1/file_1_2.txt"},
+		{raw: "Dir_1/file_1.txt", sanitized: "Dir_1/file_1_4.txt"},
+	}
+	actual := makePortableNames(files)
+	require.Equal(t, expected, actual)
+}
+
+func TestMakePortableNamesWithCollisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+	}{
+		{
+			name:     "with a unique name taken by a later entry",
+			names:    []string{"X.txt", "x.txt", "x_2.txt"},
+			expected: []string{"X.txt", "x_3.txt", "x_2.txt"},
+		},
+		{
+			name:     "with a renamed entry taking the name of a later entry",
+			names:    []string{"what?.txt", "what_.txt"},
+			expected: []string{"what__2.txt", "what_.txt"},
+		},
+		{
+			name:     "with a dir after a file of the same name",
+			names:    []string{"a", "A/", "A/file_1.txt", "a/file_2.txt"},
+			expected: []string{"a", "A_2/", "A_2/file_1.txt", "a_3/file_2.txt"},
+		},
+		{
+			name:     "with a file after a dir of the same name",
+			names:    []string{"a/file_1.txt", "A"},
+			expected: []string{"a/file_1.txt", "A_2"},
+		},
+		{
+			name:     "with a duplicate entry",
+			names:    []string{"file_1.txt", "file_1.txt"},
+			expected: []string{"file_1.txt", "file_1.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make([]*zip.File, len(tt.names))
+			for i, name := range tt.names {
+				files[i] = &zip.File{FileHeader: zip.FileHeader{Name: name}}
+			}
+			makePortableNames(files)
+			actual := make([]string, len(files))
+			for i, file := range files {
+				actual[i] = file.Name
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestMakePortableElem(t *testing.T) {
+	tests := []struct {
+		name     string
+		elem     string
+		expected string
+	}{
+		{
+			name:     "with a portable name",
+			elem:     "file_1.txt",
+			expected: "file_1.txt",
+		},
+		{
+			name:     "with invalid characters",
+			elem:     `a<b>c:d"e|f?g*h.txt`,
+			expected: "a_b_c_d_e_f_g_h.txt",
+		},
+		{
+			name:     "with a control character",
+			elem:     "file\x01.txt",
+			expected: "file_.txt",
+		},
+		{
+			name:     "with trailing dots and spaces",
+			elem:     "file_1. .",
+			expected: "file_1___",
+		},
+		{
+			name:     "with a reserved name",
+			elem:     "NUL",
+			expected: "_NUL",
+		},
+		{
+			name:     "with a reserved name and an extension",
+			elem:     "com1.tar.gz",
+			expected: "_com1.tar.gz",
+		},
+		{
+			name:     "with a reserved name prefix",
+			elem:     "console.txt",
+			expected: "console.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, makePortableElem(tt.elem))
+		})
+	}
+}
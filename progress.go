@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	progressMinSize = 1 << 30 // 1GB
+	progressStep    = 10      // percent
+)
+
+type progressReader struct {
+	reader  io.Reader
+	name    string
+	size    uint64
+	read    uint64
+	percent uint64
+	opts    unzipOptions
+}
+
+// newProgressReader logs the progress of the zip entries of at least 1GB
+// every 10 percent, since copying them takes a while.
+func newProgressReader(r io.Reader, zipEntry *zip.File, opts unzipOptions) io.Reader {
+	if !opts.progress || zipEntry.UncompressedSize64 < progressMinSize {
+		return r
+	}
+	return &progressReader{
+		reader: r,
+		name:   zipEntry.Name,
+		size:   zipEntry.UncompressedSize64,
+		opts:   opts,
+	}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += uint64(n)
+	percent := min(r.read*100/r.size, 100)
+	if percent >= r.percent+progressStep {
+		r.percent = percent - percent%progressStep
+		r.opts.logf("unzipping %s: %s of %s (%d%%)\n", r.name, formatSize(r.read), formatSize(r.size), r.percent)
+	}
+	return n, err
+}
+
+func formatSize(size uint64) string {
+	for _, unit := range sizeUnits {
+		if size >= uint64(unit.size) && unit.size > 1 {
+			return fmt.Sprintf("%.1f%s", float64(size)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
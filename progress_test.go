@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReader(t *testing.T) {
+	logWriter := &bytes.Buffer{}
+	reader := &progressReader{
+		reader: iotest.OneByteReader(strings.NewReader(strings.Repeat("a", 40))),
+		name:   "memory.raw",
+		size:   40,
+		opts:   unzipOptions{progress: true, logWriter: logWriter},
+	}
+	_, err := io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(logWriter.String()), "\n")
+	require.Len(t, lines, 10)
+	require.Equal(t, "unzipping memory.raw: 4B of 40B (10%)", lines[0])
+	require.Equal(t, "unzipping memory.raw: 40B of 40B (100%)", lines[9])
+}
+
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512B", formatSize(512))
+	require.Equal(t, "1.5KB", formatSize(1536))
+	require.Equal(t, "4.0GB", formatSize(4<<30))
+}
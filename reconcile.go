@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	unlistedModeReport  = "report"
+	unlistedModeFail    = "fail"
+	unlistedModeExtract = "extract"
+)
+
+var errInvalidUnlistedMode = errors.New("invalid unlisted mode. valid modes are report, fail and extract")
+
+type caseMismatch struct {
+	csvPath string
+	dirPath string
+}
+
+type reconciliation struct {
+	unlisted       []string
+	missing        []string
+	caseMismatches []caseMismatch
+}
+
+func validateUnlistedMode(mode string) error {
+	switch mode {
+	case unlistedModeReport, unlistedModeFail, unlistedModeExtract:
+		return nil
+	}
+	return errInvalidUnlistedMode
+}
+
+func reconcileZipFiles(dirPath string, files []zipFile, recursive bool) (reconciliation, error) {
+	dirFilePaths, err := findDirZipFiles(dirPath, recursive)
+	if err != nil {
+		return reconciliation{}, err
+	}
+
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		listed[file.path] = true
+	}
+	present := make(map[string]bool, len(dirFilePaths))
+	foldedPresent := make(map[string]string, len(dirFilePaths))
+	for _, path := range dirFilePaths {
+		present[path] = true
+		foldedPresent[strings.ToLower(path)] = path
+	}
+
+	var rec reconciliation
+	matched := make(map[string]bool)
+	for _, file := range files {
+		if present[file.path] {
+			continue
+		}
+		dirFilePath, ok := foldedPresent[strings.ToLower(file.path)]
+		if ok && !listed[dirFilePath] {
+			rec.caseMismatches = append(rec.caseMismatches, caseMismatch{csvPath: file.path, dirPath: dirFilePath})
+			matched[dirFilePath] = true
+			continue
+		}
+		rec.missing = append(rec.missing, file.path)
+	}
+	for _, path := range dirFilePaths {
+		if !listed[path] && !matched[path] {
+			rec.unlisted = append(rec.unlisted, path)
+		}
+	}
+	return rec, nil
+}
+
+func findDirZipFiles(dirPath string, recursive bool) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == dirPath {
+				return nil
+			}
+			if !recursive || isExtractedDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() && (isZipFilename(entry.Name()) || isLastSplitSegment(path)) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list zip files in dir '%s': %w", dirPath, err)
+	}
+	return paths, nil
+}
+
+func isZipFilename(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".zip")
+}
+
+// isLastSplitSegment reports whether the path is the last segment of a zip
+// file split into .zip.001, .zip.002 and so on, which names the zip file.
+func isLastSplitSegment(path string) bool {
+	match := splitSegmentPattern.FindStringSubmatch(path)
+	if match == nil {
+		return false
+	}
+	segment, _ := strconv.Atoi(match[1])
+	_, err := os.Stat(fmt.Sprintf("%s%03d", path[:len(path)-len(match[1])], segment+1))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+func isExtractedDir(path string) bool {
+	for _, ext := range []string{".zip", ".zip.001"} {
+		fileInfo, err := os.Stat(path + ext)
+		if err == nil && fileInfo.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+func printReconciliation(rec reconciliation, opts unzipOptions) {
+	for _, path := range rec.unlisted {
+		opts.logf("warning: '%s' is not listed in the csv file\n", path)
+	}
+	for _, path := range rec.missing {
+		opts.logf("warning: '%s' is listed in the csv file but not found in the dir\n", path)
+	}
+	for _, mismatch := range rec.caseMismatches {
+		opts.logf("warning: '%s' is listed in the csv file but found as '%s' in the dir\n", mismatch.csvPath, mismatch.dirPath)
+	}
+}
+
+func applyReconciliation(rec reconciliation, files []zipFile, mode string, defaultPassword string) ([]zipFile, error) {
+	switch mode {
+	case unlistedModeFail:
+		var errs []error
+		for _, path := range rec.unlisted {
+			errs = append(errs, fmt.Errorf("'%s' is not listed in the csv file", path))
+		}
+		for _, mismatch := range rec.caseMismatches {
+			errs = append(errs, fmt.Errorf("'%s' is listed in the csv file with a different case as '%s'", mismatch.dirPath, mismatch.csvPath))
+		}
+		if len(errs) > 0 {
+			return nil, makeMultiErr("failed to reconcile csv file with dir", errs)
+		}
+	case unlistedModeExtract:
+		for _, path := range rec.unlisted {
+			file := zipFile{
+				path:     path,
+				password: defaultPassword,
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateUnlistedMode(t *testing.T) {
+	require.NoError(t, validateUnlistedMode(unlistedModeReport))
+	require.NoError(t, validateUnlistedMode(unlistedModeFail))
+	require.NoError(t, validateUnlistedMode(unlistedModeExtract))
+	require.ErrorIs(t, validateUnlistedMode("ignore"), errInvalidUnlistedMode)
+}
+
+func TestReconcileZipFiles(t *testing.T) {
+	dirPath, err := os.MkdirTemp("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dirPath)
+
+	for _, name := range []string{"file_1.zip", "file_2.zip", "File_3.ZIP", "file_4.txt", "sub/file_5.zip", "file_1/file_6.zip", "file_8.zip.001", "file_8.zip.002"} {
+		path := filepath.Join(dirPath, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	files := []zipFile{
+		{path: filepath.Join(dirPath, "file_1.zip")},
+		{path: filepath.Join(dirPath, "file_3.zip")},
+		{path: filepath.Join(dirPath, "file_7.zip")},
+	}
+
+	tests := []struct {
+		name      string
+		recursive bool
+		expected  reconciliation
+	}{
+		{
+			name:      "without recursion",
+			recursive: false,
+			expected: reconciliation{
+				unlisted: []string{filepath.Join(dirPath, "file_2.zip"), filepath.Join(dirPath, "file_8.zip.002")},
+				missing:  []string{filepath.Join(dirPath, "file_7.zip")},
+				caseMismatches: []caseMismatch{
+					{
+						csvPath: filepath.Join(dirPath, "file_3.zip"),
+						dirPath: filepath.Join(dirPath, "File_3.ZIP"),
+					},
+				},
+			},
+		},
+		{
+			name:      "with recursion",
+			recursive: true,
+			expected: reconciliation{
+				unlisted: []string{filepath.Join(dirPath, "file_2.zip"), filepath.Join(dirPath, "file_8.zip.002"), filepath.Join(dirPath, "sub", "file_5.zip")},
+				missing:  []string{filepath.Join(dirPath, "file_7.zip")},
+				caseMismatches: []caseMismatch{
+					{
+						csvPath: filepath.Join(dirPath, "file_3.zip"),
+						dirPath: filepath.Join(dirPath, "File_3.ZIP"),
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := reconcileZipFiles(dirPath, files, tt.recursive)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestApplyReconciliation(t *testing.T) {
+	files := []zipFile{
+		{path: "file_1.zip", password: "password_1"},
+	}
+	rec := reconciliation{
+		unlisted: []string{"file_2.zip"},
+	}
+	tests := []struct {
+		name      string
+		mode      string
+		expected  []zipFile
+		expectErr bool
+	}{
+		{
+			name:     "with report mode",
+			mode:     unlistedModeReport,
+			expected: files,
+		},
+		{
+			name:      "with fail mode",
+			mode:      unlistedModeFail,
+			expectErr: true,
+		},
+		{
+			name: "with extract mode",
+			mode: unlistedModeExtract,
+			expected: []zipFile{
+				{path: "file_1.zip", password: "password_1"},
+				{path: "file_2.zip", password: "default"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := applyReconciliation(rec, files, tt.mode, "default")
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestPrintReconciliation(t *testing.T) {
+	rec := reconciliation{
+		unlisted: []string{"file_2.zip"},
+		missing:  []string{"file_7.zip"},
+		caseMismatches: []caseMismatch{
+			{csvPath: "file_3.zip", dirPath: "File_3.ZIP"},
+		},
+	}
+	var buf bytes.Buffer
+	printReconciliation(rec, unzipOptions{logWriter: &buf})
+	expected := "warning: 'file_2.zip' is not listed in the csv file\n" +
+		"warning: 'file_7.zip' is listed in the csv file but not found in the dir\n" +
+		"warning: 'file_3.zip' is listed in the csv file but found as 'File_3.ZIP' in the dir\n"
+	require.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	localHeaderLen          = 30
+	localHeaderSignature    = 0x04034b50
+	dataDescriptorSignature = 0x08074b50
+	recoverChunkSize        = 64 * 1024
+)
+
+var (
+	errNoLocalHeaders   = errors.New("no local headers found")
+	errTruncatedHeader  = errors.New("local header is truncated")
+	errTruncatedData    = errors.New("entry data is truncated")
+	errExtraTooLong     = errors.New("extra field is too long")
+	errNoDataDescriptor = errors.New("data descriptor not found")
+)
+
+type unrecoverableEntry struct {
+	name   string
+	offset int64
+	reason string
+}
+
+type localEntry struct {
+	header           []byte
+	name             []byte
+	extra            []byte
+	crc32            uint32
+	compressedSize   uint64
+	uncompressedSize uint64
+}
+
+// recoverZipFile rebuilds the central directory of a truncated or damaged zip
+// file from its local headers, and appends it to the zip file to read it
+// with the zip package. The scan skips the data of the entries whose sizes
+// can be read, even if they can't be recovered, so the headers of a stored
+// nested zip file aren't recovered as entries, and only resyncs byte by byte
+// after a header without readable sizes. It stops at the first truncated
+// entry, since the following bytes can't contain intact entries.
+func recoverZipFile(r io.ReaderAt, size int64) (*zip.Reader, []unrecoverableEntry, error) {
+	var directory bytes.Buffer
+	var count int
+	var unrecoverable []unrecoverableEntry
+	offset := int64(0)
+	for {
+		var found bool
+		offset, found = findLocalHeader(r, size, offset)
+		if !found {
+			break
+		}
+		entry, end, err := readLocalEntry(r, size, offset)
+		if err != nil {
+			unrecoverable = append(unrecoverable, unrecoverableEntry{name: string(entry.name), offset: offset, reason: err.Error()})
+			if errors.Is(err, errTruncatedHeader) || errors.Is(err, errTruncatedData) || errors.Is(err, errNoDataDescriptor) {
+				break
+			}
+			offset = max(end, offset+4)
+			continue
+		}
+		directory.Write(entry.directoryHeader(offset))
+		count++
+		offset = end
+	}
+	if count == 0 && len(unrecoverable) == 0 {
+		return nil, nil, errNoLocalHeaders
+	}
+
+	directory.Write(makeDirectoryEnd(size, int64(directory.Len()), count))
+	recovered := &appendedReader{reader: r, size: size, data: directory.Bytes()}
+	zipReader, err := zip.NewReader(recovered, recovered.Size())
+	if err != nil {
+		return nil, nil, err
+	}
+	return zipReader, unrecoverable, nil
+}
+
+// findLocalHeader finds the next local header from the offset, skipping the
+// damaged bytes, and stops at the central directory.
+func findLocalHeader(r io.ReaderAt, size int64, offset int64) (int64, bool) {
+	for pos, signature := range findSignatures(r, size, offset) {
+		switch signature {
+		case localHeaderSignature:
+			return pos, true
+		case directoryHeaderSignature, directory64EndSignature, directoryEndSignature:
+			if pos == offset {
+				return 0, false
+			}
+		}
+	}
+	return 0, false
+}
+
+// readLocalEntry reads the local header of an entry and finds the end of its
+// data. The end is also returned with the errors of an entry whose data can
+// be skipped.
+func readLocalEntry(r io.ReaderAt, size int64, offset int64) (localEntry, int64, error) {
+	entry, isZip64, err := readLocalHeader(r, offset)
+	if err != nil {
+		return entry, 0, err
+	}
+	end, err := entry.findEnd(r, size, offset, isZip64)
+	if err == nil && len(entry.extra)+28 > math.MaxUint16 {
+		err = errExtraTooLong
+	}
+	return entry, end, err
+}
+
+func (e *localEntry) findEnd(r io.ReaderAt, size int64, offset int64, isZip64 bool) (int64, error) {
+	dataOffset := e.dataOffset(offset)
+	hasDataDescriptor := e.hasDataDescriptor()
+	if hasDataDescriptor && e.compressedSize == 0 {
+		return e.findDataDescriptor(r, size, dataOffset)
+	}
+	end := dataOffset + int64(e.compressedSize)
+	if end > size {
+		return 0, errTruncatedData
+	}
+	if hasDataDescriptor {
+		return e.skipDataDescriptor(r, end, isZip64), nil
+	}
+	return end, nil
+}
+
+func readLocalHeader(r io.ReaderAt, offset int64) (localEntry, bool, error) {
+	var entry localEntry
+	entry.header = make([]byte, localHeaderLen)
+	_, err := r.ReadAt(entry.header, offset)
+	if err != nil {
+		return entry, false, errTruncatedHeader
+	}
+	nameLen := int(binary.LittleEndian.Uint16(entry.header[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(entry.header[28:]))
+	data := make([]byte, nameLen+extraLen)
+	n, err := r.ReadAt(data, offset+localHeaderLen)
+	entry.name = data[:min(n, nameLen)]
+	if err != nil {
+		return entry, false, errTruncatedHeader
+	}
+	entry.extra = data[nameLen:]
+	isZip64, err := entry.readSizes()
+	return entry, isZip64, err
+}
+
+func (e *localEntry) dataOffset(offset int64) int64 {
+	return offset + localHeaderLen + int64(len(e.name)+len(e.extra))
+}
+
+// readSizes reads the crc-32 and the sizes of the local header, which are
+// zero when they are written to a data descriptor.
+func (e *localEntry) readSizes() (bool, error) {
+	e.crc32 = binary.LittleEndian.Uint32(e.header[14:])
+	e.compressedSize = uint64(binary.LittleEndian.Uint32(e.header[18:]))
+	e.uncompressedSize = uint64(binary.LittleEndian.Uint32(e.header[22:]))
+	var err error
+	zip64Data, isZip64 := findExtraField(e.extra, zip64ExtraID)
+	if isZip64 && e.uncompressedSize == math.MaxUint32 {
+		e.uncompressedSize, zip64Data, err = readZip64Field(zip64Data)
+	}
+	if err == nil && isZip64 && e.compressedSize == math.MaxUint32 {
+		e.compressedSize, _, err = readZip64Field(zip64Data)
+	}
+	return isZip64, err
+}
+
+func (e *localEntry) flags() uint16 {
+	return binary.LittleEndian.Uint16(e.header[6:])
+}
+
+func (e *localEntry) hasDataDescriptor() bool {
+	return e.flags()&0x8 != 0
+}
+
+// findDataDescriptor finds the data descriptor of an entry written without
+// its sizes in the local header. The descriptor is the one whose compressed
+// size matches its offset, and it may be written without its signature.
+func (e *localEntry) findDataDescriptor(r io.ReaderAt, size int64, dataOffset int64) (int64, error) {
+	buf := make([]byte, 24)
+	for pos, signature := range findSignatures(r, size, dataOffset) {
+		if signature == dataDescriptorSignature {
+			n, _ := r.ReadAt(buf, pos)
+			if n >= 16 && int64(binary.LittleEndian.Uint32(buf[8:])) == pos-dataOffset {
+				e.setDataDescriptor(buf[4:], false)
+				return pos + 16, nil
+			}
+			if n == 24 && int64(binary.LittleEndian.Uint64(buf[8:])) == pos-dataOffset {
+				e.setDataDescriptor(buf[4:], true)
+				return pos + 24, nil
+			}
+			continue
+		}
+		if signature != localHeaderSignature && signature != directoryHeaderSignature {
+			continue
+		}
+		if pos-12 >= dataOffset {
+			_, _ = r.ReadAt(buf[:12], pos-12)
+			if int64(binary.LittleEndian.Uint32(buf[4:])) == pos-12-dataOffset {
+				e.setDataDescriptor(buf, false)
+				return pos, nil
+			}
+		}
+		if pos-20 >= dataOffset {
+			_, _ = r.ReadAt(buf[:20], pos-20)
+			if int64(binary.LittleEndian.Uint64(buf[4:])) == pos-20-dataOffset {
+				e.setDataDescriptor(buf, true)
+				return pos, nil
+			}
+		}
+	}
+	return 0, errNoDataDescriptor
+}
+
+func (e *localEntry) skipDataDescriptor(r io.ReaderAt, end int64, isZip64 bool) int64 {
+	buf := make([]byte, 24)
+	n, _ := r.ReadAt(buf, end)
+	descriptor := buf[:n]
+	if n >= 4 && binary.LittleEndian.Uint32(buf) == dataDescriptorSignature {
+		descriptor = buf[4:n]
+		end += 4
+	}
+	descriptorLen := 12
+	if isZip64 {
+		descriptorLen = 20
+	}
+	if len(descriptor) < descriptorLen {
+		return end
+	}
+	if e.crc32 == 0 {
+		e.crc32 = binary.LittleEndian.Uint32(descriptor)
+	}
+	return end + int64(descriptorLen)
+}
+
+// setDataDescriptor reads the crc-32 and the sizes of a data descriptor
+// without its signature.
+func (e *localEntry) setDataDescriptor(descriptor []byte, isZip64 bool) {
+	e.crc32 = binary.LittleEndian.Uint32(descriptor)
+	if isZip64 {
+		e.compressedSize = binary.LittleEndian.Uint64(descriptor[4:])
+		e.uncompressedSize = binary.LittleEndian.Uint64(descriptor[12:])
+		return
+	}
+	e.compressedSize = uint64(binary.LittleEndian.Uint32(descriptor[4:]))
+	e.uncompressedSize = uint64(binary.LittleEndian.Uint32(descriptor[8:]))
+}
+
+// directoryHeader makes a central directory header from the local header,
+// always storing the sizes and the offset in a zip64 extra field.
+func (e localEntry) directoryHeader(offset int64) []byte {
+	extra := binary.LittleEndian.AppendUint16(nil, zip64ExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, 24)
+	extra = binary.LittleEndian.AppendUint64(extra, e.uncompressedSize)
+	extra = binary.LittleEndian.AppendUint64(extra, e.compressedSize)
+	extra = binary.LittleEndian.AppendUint64(extra, uint64(offset))
+	extra = append(extra, removeExtraField(e.extra, zip64ExtraID)...)
+
+	header := make([]byte, directoryHeaderLen)
+	binary.LittleEndian.PutUint32(header, directoryHeaderSignature)
+	// the local header doesn't store the creator, so the entries are read as
+	// created on ms-dos without attributes.
+	binary.LittleEndian.PutUint16(header[4:], binary.LittleEndian.Uint16(e.header[4:])&0xff)
+	copy(header[6:16], e.header[4:14]) // version, flags, method, time and date
+	binary.LittleEndian.PutUint32(header[16:], e.crc32)
+	binary.LittleEndian.PutUint32(header[20:], math.MaxUint32)
+	binary.LittleEndian.PutUint32(header[24:], math.MaxUint32)
+	binary.LittleEndian.PutUint16(header[28:], uint16(len(e.name)))
+	binary.LittleEndian.PutUint16(header[30:], uint16(len(extra)))
+	binary.LittleEndian.PutUint32(header[42:], math.MaxUint32)
+	header = append(header, e.name...)
+	return append(header, extra...)
+}
+
+func makeDirectoryEnd(dirOffset int64, dirSize int64, count int) []byte {
+	end64 := make([]byte, directory64EndLen)
+	binary.LittleEndian.PutUint32(end64, directory64EndSignature)
+	binary.LittleEndian.PutUint64(end64[4:], directory64EndLen-12)
+	binary.LittleEndian.PutUint16(end64[12:], 45)
+	binary.LittleEndian.PutUint16(end64[14:], 45)
+	binary.LittleEndian.PutUint64(end64[24:], uint64(count))
+	binary.LittleEndian.PutUint64(end64[32:], uint64(count))
+	binary.LittleEndian.PutUint64(end64[40:], uint64(dirSize))
+	binary.LittleEndian.PutUint64(end64[48:], uint64(dirOffset))
+
+	loc := make([]byte, directory64LocLen)
+	binary.LittleEndian.PutUint32(loc, directory64LocSignature)
+	binary.LittleEndian.PutUint64(loc[8:], uint64(dirOffset+dirSize))
+	binary.LittleEndian.PutUint32(loc[16:], 1)
+
+	end := make([]byte, directoryEndLen)
+	binary.LittleEndian.PutUint32(end, directoryEndSignature)
+	binary.LittleEndian.PutUint16(end[8:], uint16(min(count, math.MaxUint16)))
+	binary.LittleEndian.PutUint16(end[10:], uint16(min(count, math.MaxUint16)))
+	binary.LittleEndian.PutUint32(end[12:], math.MaxUint32)
+	binary.LittleEndian.PutUint32(end[16:], math.MaxUint32)
+
+	return append(append(end64, loc...), end...)
+}
+
+func removeExtraField(extra []byte, id uint16) []byte {
+	var result []byte
+	for len(extra) >= 4 {
+		fieldID := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if fieldID != id {
+			result = append(result, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	return result
+}
+
+// findSignatures iterates over the zip signatures from the offset.
+func findSignatures(r io.ReaderAt, size int64, offset int64) func(yield func(int64, uint32) bool) {
+	return func(yield func(int64, uint32) bool) {
+		buf := make([]byte, recoverChunkSize)
+		for offset+4 <= size {
+			n, err := r.ReadAt(buf[:min(int64(len(buf)), size-offset)], offset)
+			if n < 4 {
+				return
+			}
+			for i := 0; i+4 <= n; i++ {
+				if buf[i] != 'P' || buf[i+1] != 'K' {
+					continue
+				}
+				if !yield(offset+int64(i), binary.LittleEndian.Uint32(buf[i:])) {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+			offset += int64(n - 3)
+		}
+	}
+}
+
+type appendedReader struct {
+	reader io.ReaderAt
+	size   int64
+	data   []byte
+}
+
+func (r *appendedReader) Size() int64 {
+	return r.size + int64(len(r.data))
+}
+
+func (r *appendedReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < r.size {
+		var err error
+		n, err = r.reader.ReadAt(p[:min(int64(len(p)), r.size-off)], off)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		dataOffset := off + int64(n) - r.size
+		if dataOffset < 0 || dataOffset >= int64(len(r.data)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], r.data[dataOffset:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
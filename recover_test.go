@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithRecover(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "logs/security.evtx", content: "security"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	tests := []struct {
+		name        string
+		password    string
+		createFile  func(t *testing.T, password string) string
+		truncate    func(data []byte) int
+		expected    map[string]string
+		expectedErr string
+	}{
+		{
+			name: "without the central directory",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			truncate: findCentralDirectory,
+			expected: map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+				"files/readme.txt":   "readme",
+			},
+		},
+		{
+			name: "with a truncated entry",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			truncate: func(data []byte) int {
+				return bytes.LastIndex(data[:findCentralDirectory(data)], []byte("PK\x03\x04")) + 50
+			},
+			expected: map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+			},
+			expectedErr: "failed to recover zip entry 'files/readme.txt'",
+		},
+		{
+			name:     "with encrypted entries",
+			password: "password_1",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			truncate: func(data []byte) int {
+				return findCentralDirectory(data) - 10
+			},
+			expected: map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+			},
+			expectedErr: "failed to recover zip entry 'files/readme.txt'",
+		},
+		{
+			name:       "with stored entries",
+			createFile: createStoredTestZipFile,
+			truncate:   findCentralDirectory,
+			expected: map[string]string{
+				"logs/system.evtx": "system",
+				"files/readme.txt": "readme",
+			},
+		},
+		{
+			name:       "with a damaged entry storing a zip file",
+			createFile: createDamagedTestZipFile,
+			truncate: func(data []byte) int {
+				nestedEnd := bytes.Index(data, []byte("PK\x05\x06"))
+				return nestedEnd + findCentralDirectory(data[nestedEnd:])
+			},
+			expected: map[string]string{
+				"files/readme.txt": "readme",
+			},
+			expectedErr: "failed to recover zip entry 'evidence.zip' at offset 0: extra field is too long",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := tt.createFile(t, tt.password)
+			data, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filePath, data[:tt.truncate(data)], 0644))
+
+			err = unzipFile(context.Background(), filePath, tt.password, unzipOptions{logWriter: &bytes.Buffer{}})
+			require.Error(t, err, "truncated zip file must fail without recover")
+
+			opts := unzipOptions{
+				recover:   true,
+				logWriter: &bytes.Buffer{},
+			}
+			err = unzipFile(context.Background(), filePath, tt.password, opts)
+			if len(tt.expectedErr) > 0 {
+				require.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			requireDirContent(t, makeDirPath(filePath), tt.expected)
+		})
+	}
+}
+
+func TestRemoveExtraField(t *testing.T) {
+	extra := []byte{0x01, 0x00, 0x02, 0x00, 0xaa, 0xbb, 0x75, 0x70, 0x01, 0x00, 0xcc}
+	require.Equal(t, []byte{0x75, 0x70, 0x01, 0x00, 0xcc}, removeExtraField(extra, zip64ExtraID))
+}
+
+func findCentralDirectory(data []byte) int {
+	return bytes.Index(data, []byte("PK\x01\x02"))
+}
+
+// createStoredTestZipFile creates a zip file with stored entries followed by
+// data descriptors, so the local headers have no sizes.
+func createStoredTestZipFile(t *testing.T, _ string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for _, entry := range []testZipEntry{{name: "logs/system.evtx", content: "system"}, {name: "files/readme.txt", content: "readme"}} {
+		entryWriter, err := writer.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = entryWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	return filePath
+}
+
+// createDamagedTestZipFile creates a zip file whose first entry stores a zip
+// file, with an extra field too long to be recovered.
+func createDamagedTestZipFile(t *testing.T, _ string) string {
+	t.Helper()
+	var nested bytes.Buffer
+	nestedWriter := zip.NewWriter(&nested)
+	entryWriter, err := nestedWriter.CreateHeader(&zip.FileHeader{Name: "inner.txt", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = entryWriter.Write([]byte("inner"))
+	require.NoError(t, err)
+	require.NoError(t, nestedWriter.Close())
+
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	extra := binary.LittleEndian.AppendUint16(nil, 0x6666)
+	extra = binary.LittleEndian.AppendUint16(extra, math.MaxUint16-31)
+	extra = append(extra, make([]byte, math.MaxUint16-31)...)
+	// the raw header stores the sizes, so the data can be skipped without a
+	// data descriptor.
+	entryWriter, err = writer.CreateRaw(&zip.FileHeader{
+		Name:               "evidence.zip",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(nested.Bytes()),
+		CompressedSize64:   uint64(nested.Len()),
+		UncompressedSize64: uint64(nested.Len()),
+		Extra:              extra,
+	})
+	require.NoError(t, err)
+	_, err = entryWriter.Write(nested.Bytes())
+	require.NoError(t, err)
+	entryWriter, err = writer.CreateHeader(&zip.FileHeader{Name: "files/readme.txt", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = entryWriter.Write([]byte("readme"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return filePath
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type unzipReport struct {
+	filePath        string
+	extracted       int
+	filtered        int
+	failed          int
+	skippedSymlinks int
+	decodedNames    []decodedName
+	skippedNames    []string
+	sanitizedNames  []sanitizedName
+	portableNames   []sanitizedName
+	unrecoverable   []unrecoverableEntry
+	sealedAt        time.Time
+}
+
+func (r unzipReport) String() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "unzipped %s: %d entries extracted, %d filtered out, %d failed", r.filePath, r.extracted, r.filtered, r.failed)
+	if r.skippedSymlinks > 0 {
+		fmt.Fprintf(&builder, ", %d symlinks skipped", r.skippedSymlinks)
+	}
+	if len(r.decodedNames) > 0 {
+		fmt.Fprintf(&builder, ", %d names decoded", len(r.decodedNames))
+	}
+	if len(r.skippedNames) > 0 {
+		fmt.Fprintf(&builder, ", %d insecure entries skipped", len(r.skippedNames))
+	}
+	if len(r.sanitizedNames) > 0 {
+		fmt.Fprintf(&builder, ", %d insecure entries sanitized", len(r.sanitizedNames))
+	}
+	if len(r.portableNames) > 0 {
+		fmt.Fprintf(&builder, ", %d names made portable", len(r.portableNames))
+	}
+	if len(r.unrecoverable) > 0 {
+		fmt.Fprintf(&builder, ", %d entries unrecoverable", len(r.unrecoverable))
+	}
+	if !r.sealedAt.IsZero() {
+		fmt.Fprintf(&builder, ", sealed at %s", r.sealedAt.Format(time.RFC3339))
+	}
+	for _, name := range r.decodedNames {
+		fmt.Fprintf(&builder, "\n- decoded name %q as '%s'", name.raw, name.decoded)
+	}
+	for _, name := range r.skippedNames {
+		fmt.Fprintf(&builder, "\n- skipped insecure entry %q", name)
+	}
+	for _, name := range r.sanitizedNames {
+		fmt.Fprintf(&builder, "\n- sanitized insecure entry %q as '%s'", name.raw, name.sanitized)
+	}
+	for _, name := range r.portableNames {
+		fmt.Fprintf(&builder, "\n- renamed %q as '%s'", name.raw, name.sanitized)
+	}
+	for _, entry := range r.unrecoverable {
+		fmt.Fprintf(&builder, "\n- unrecoverable entry %q at offset %d: %s", entry.name, entry.offset, entry.reason)
+	}
+	return builder.String()
+}
+
+// logReport prints the report of a zip file, unless the zip file failed before
+// it was read.
+func (opts unzipOptions) logReport(report unzipReport) {
+	if report.filePath != "" {
+		opts.logf("%s\n", report)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipReportString(t *testing.T) {
+	report := unzipReport{
+		filePath:  "/tmp/file_1.zip",
+		extracted: 3,
+		filtered:  2,
+		failed:    1,
+	}
+	expected := "unzipped /tmp/file_1.zip: 3 entries extracted, 2 filtered out, 1 failed"
+	require.Equal(t, expected, report.String())
+}
+
+func TestUnzipReportStringWithNames(t *testing.T) {
+	report := unzipReport{
+		filePath:       "/tmp/file_1.zip",
+		extracted:      2,
+		decodedNames:   []decodedName{{raw: "\x80.txt", decoded: "Ç.txt"}},
+		skippedNames:   []string{"../file_2.txt"},
+		sanitizedNames: []sanitizedName{{raw: "/file_3.txt", sanitized: "_insecure/file_3.txt"}},
+		portableNames:  []sanitizedName{{raw: "file:4.txt", sanitized: "file_4.txt"}},
+		unrecoverable:  []unrecoverableEntry{{name: "file_5.txt", offset: 120, reason: "entry data is truncated"}},
+	}
+	expected := "unzipped /tmp/file_1.zip: 2 entries extracted, 0 filtered out, 0 failed, 1 names decoded, 1 insecure entries skipped, 1 insecure entries sanitized, 1 names made portable, 1 entries unrecoverable" +
+		"\n- decoded name \"\\x80.txt\" as 'Ç.txt'" +
+		"\n- skipped insecure entry \"../file_2.txt\"" +
+		"\n- sanitized insecure entry \"/file_3.txt\" as '_insecure/file_3.txt'" +
+		"\n- renamed \"file:4.txt\" as 'file_4.txt'" +
+		"\n- unrecoverable entry \"file_5.txt\" at offset 120: entry data is truncated"
+	require.Equal(t, expected, report.String())
+}
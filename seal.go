@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	writeModeBits     = 0222 // 0222: -w--w--w-
+	ownerWriteModeBit = 0200 // 0200: -w-------
+
+	sealRecordSuffix = ".seal.csv"
+	pathColName      = "Path"
+	modeColName      = "Mode"
+)
+
+// sealDir removes the write bits from everything in the root and the root
+// itself, after recording the modes they had in the seal record next to the
+// root, so the unzipped tree only has the entries of the zip file. The content
+// is changed before its dir, so the dir stays writable until the content is
+// sealed.
+func sealDir(root *os.Root) (time.Time, error) {
+	entries, err := listRootTree(root)
+	if err != nil {
+		return time.Time{}, err
+	}
+	err = writeSealRecord(makeSealRecordPath(root.Name()), entries)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, entry := range slices.Backward(entries) {
+		if entry.mode&os.ModeSymlink != 0 {
+			continue
+		}
+		err = root.Chmod(entry.name, entry.mode.Perm()&^writeModeBits)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to seal '%s': %w", filepath.Join(root.Name(), entry.name), err)
+		}
+	}
+	return time.Now(), nil
+}
+
+// unsealDir gives the write bit back to the owner of the entries it was
+// removed from, so the dir can be changed by the unzipping user without opening
+// it to everyone or making the entries which were read-only in the zip file
+// writable. The seal record is removed afterwards.
+func unsealDir(dirPath string) error {
+	root, err := os.OpenRoot(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dir '%s': %w", dirPath, err)
+	}
+	defer root.Close()
+
+	recordPath := makeSealRecordPath(dirPath)
+	modes, err := readSealRecord(recordPath)
+	if err != nil {
+		return err
+	}
+	entries, err := listRootTree(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		mode, ok := modes[entry.name]
+		if !ok || entry.mode&os.ModeSymlink != 0 || mode&ownerWriteModeBit == 0 {
+			continue
+		}
+		err = root.Chmod(entry.name, entry.mode.Perm()|ownerWriteModeBit)
+		if err != nil {
+			return fmt.Errorf("failed to unseal '%s': %w", filepath.Join(dirPath, entry.name), err)
+		}
+	}
+	err = os.Remove(recordPath)
+	if err != nil {
+		return fmt.Errorf("failed to remove seal record '%s': %w", recordPath, err)
+	}
+	return nil
+}
+
+func makeSealRecordPath(dirPath string) string {
+	return filepath.Clean(dirPath) + sealRecordSuffix
+}
+
+func writeSealRecord(recordPath string, entries []treeEntry) error {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{pathColName, modeColName})
+	for _, entry := range entries {
+		_ = writer.Write([]string{filepath.ToSlash(entry.name), fmt.Sprintf("%04o", entry.mode.Perm())})
+	}
+	writer.Flush()
+	err := writer.Error()
+	if err == nil {
+		err = os.WriteFile(recordPath, buf.Bytes(), 0644) // 0644: rw-r--r--
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write seal record '%s': %w", recordPath, err)
+	}
+	return nil
+}
+
+// readSealRecord reads the modes the entries had before the dir was sealed.
+func readSealRecord(recordPath string) (map[string]os.FileMode, error) {
+	file, err := os.Open(recordPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open seal record '%s': %w", recordPath, err)
+	}
+	defer file.Close()
+	lines, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seal record '%s': %w", recordPath, err)
+	}
+	if len(lines) == 0 || !slices.Equal(lines[0], []string{pathColName, modeColName}) {
+		return nil, fmt.Errorf("invalid seal record '%s': header must be '%s,%s'", recordPath, pathColName, modeColName)
+	}
+	modes := make(map[string]os.FileMode, len(lines)-1)
+	for i, line := range lines[1:] {
+		mode, err := strconv.ParseUint(line[1], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode on line %d of seal record '%s': %w", i+2, recordPath, err)
+		}
+		modes[filepath.FromSlash(line[0])] = os.FileMode(mode)
+	}
+	return modes, nil
+}
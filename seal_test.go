@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithSeal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix modes are not supported on windows")
+	}
+	entries := []testZipEntry{
+		{name: "dir_1/"},
+		{name: "dir_1/file_1.txt", content: "content_1", mode: 0664},
+		{name: "file_2.txt", content: "content_2", mode: 0600},
+		{name: "file_3.txt", content: "content_3", mode: 0444},
+		{name: "_seal.csv", content: "content_4", mode: 0644},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		seal:      true,
+		logWriter: &logs,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	dirPath := makeDirPath(filePath)
+	t.Cleanup(func() {
+		_ = unsealDir(dirPath)
+	})
+	require.Regexp(t, `unzipped .*, sealed at \S+\n`, logs.String())
+
+	expected := map[string]os.FileMode{
+		".":                os.ModeDir | 0555,
+		"dir_1":            os.ModeDir | 0555,
+		"dir_1/file_1.txt": 0444,
+		"file_2.txt":       0400,
+		"file_3.txt":       0444,
+		"_seal.csv":        0444,
+	}
+	requireModes(t, dirPath, expected)
+	require.FileExists(t, makeSealRecordPath(dirPath))
+
+	err = unsealDir(dirPath)
+	require.NoError(t, err)
+	require.NoFileExists(t, makeSealRecordPath(dirPath))
+	expected = map[string]os.FileMode{
+		".":                os.ModeDir | 0755,
+		"dir_1":            os.ModeDir | 0755,
+		"dir_1/file_1.txt": 0644,
+		"file_2.txt":       0600,
+		"file_3.txt":       0444,
+		"_seal.csv":        0644,
+	}
+	requireModes(t, dirPath, expected)
+	requireDirContent(t, dirPath, map[string]string{
+		"dir_1/file_1.txt": "content_1",
+		"file_2.txt":       "content_2",
+		"file_3.txt":       "content_3",
+		"_seal.csv":        "content_4",
+	})
+}
+
+func TestUnsealDirWithoutSealRecord(t *testing.T) {
+	dirPath := t.TempDir()
+	err := unsealDir(dirPath)
+	require.ErrorContains(t, err, "failed to open seal record")
+}
+
+func TestUnzipFileWithSealAndErrors(t *testing.T) {
+	filePath := createTestZipFile(t, []testZipEntry{{name: "file_1.txt", content: "content_1"}}, "password_1")
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		seal:      true,
+		logWriter: &logs,
+	}
+	err := unzipFile(context.Background(), filePath, "password_2", opts)
+	require.Error(t, err)
+	require.NotContains(t, logs.String(), "sealed")
+}
+
+func requireModes(t *testing.T, dirPath string, expected map[string]os.FileMode) {
+	t.Helper()
+	for name, mode := range expected {
+		info, err := os.Lstat(filepath.Join(dirPath, name))
+		require.NoError(t, err)
+		require.Equal(t, mode, info.Mode(), name)
+	}
+}
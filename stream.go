@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const stdinName = "stdin"
+
+type streamReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// ReadByte lets the flate reader read exactly the deflate stream of an entry
+// written without its sizes, so the data descriptor can be read after it.
+func (r *streamReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.offset++
+	}
+	return b, err
+}
+
+type streamEntry struct {
+	localEntry
+	zipEntry   *zip.File
+	stream     *streamReader
+	isZip64    bool
+	dataOffset int64
+	data       *io.LimitedReader
+	reader     io.ReadCloser
+	hash       hash.Hash32
+	size       uint64
+	ended      bool
+}
+
+type streamUnzipper struct {
+	ctx         context.Context
+	root        *os.Root
+	password    string
+	opts        unzipOptions
+	report      unzipReport
+	errs        []error
+	nestedNames []string
+}
+
+// unzipStdin unzips a zip file read from stdin to the stdin_unzipped dir. The
+// entries are unzipped from their local headers while the zip file is read,
+// and the rest of the zip file is spooled to a temp file from the first entry
+// that can't be unzipped that way, i.e. an encrypted entry or an entry written
+// without its sizes which isn't deflated. The options requiring the whole
+// entry list spool the zip file from the start, and it is unzipped under the
+// stdin name.
+func unzipStdin(ctx context.Context, r io.Reader, password string, opts unzipOptions) error {
+	dirPath := makeDirPath(stdinName)
+	if requiresCentralDirectory(opts) {
+		filePath, err := spoolStream(r, 0, nil)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(filePath)
+		opts.logf("spooled %s to %s to read its central directory\n", stdinName, filePath)
+		return unzipFileToDir(ctx, zipSource{name: stdinName, path: filePath}, dirPath, password, opts)
+	}
+	return unzipToDir(dirPath, opts, func(root *os.Root) (unzipReport, error) {
+		return unzipStreamToRoot(ctx, r, root, password, opts)
+	})
+}
+
+// requiresCentralDirectory reports whether the options need the entry list or
+// the file attributes, which are only stored in the central directory. An
+// insecure entry is rejected when its local header is read, leaving the
+// entries before it unzipped as the other errors do, but sanitizing it needs
+// the names of all entries.
+func requiresCentralDirectory(opts unzipOptions) bool {
+	return opts.insecureEntries == insecureEntriesSanitize ||
+		opts.modes.policy == modePolicyPreserveSafe ||
+		opts.portableNames ||
+		opts.symlinks == symlinksCreate ||
+		opts.symlinks == symlinksSkip ||
+		opts.xattrs ||
+		opts.recover
+}
+
+func unzipStreamToRoot(ctx context.Context, r io.Reader, root *os.Root, password string, opts unzipOptions) (unzipReport, error) {
+	u := &streamUnzipper{
+		ctx:      ctx,
+		root:     root,
+		password: password,
+		opts:     opts,
+		report:   unzipReport{filePath: stdinName},
+	}
+	opts.logf("unzipping %s...\n", stdinName)
+	err := u.unzipStream(&streamReader{reader: bufio.NewReaderSize(r, defaultBufSize)})
+	if err != nil {
+		u.errs = append(u.errs, err)
+	}
+
+	var errs []error
+	if len(u.errs) > 0 {
+		errs = append(errs, makeMultiErr(fmt.Sprintf("failed to unzip file '%s'", stdinName), u.errs))
+	}
+	filtered, nestedErrs := unzipNestedArchives(ctx, root, u.nestedNames, password, opts)
+	u.report.filtered += filtered
+	errs = append(errs, nestedErrs...)
+	if len(errs) > 0 {
+		return u.report, joinMultiErrs(errs)
+	}
+	return u.report, nil
+}
+
+func (u *streamUnzipper) unzipStream(stream *streamReader) error {
+	for {
+		err := u.ctx.Err()
+		if err != nil {
+			return fmt.Errorf("context error: %w", err)
+		}
+
+		entryOffset := stream.offset
+		signature, err := stream.reader.Peek(4)
+		if err != nil {
+			return fmt.Errorf("failed to read local header at offset %d: %w", entryOffset, err)
+		}
+		switch binary.LittleEndian.Uint32(signature) {
+		case localHeaderSignature:
+		case directoryHeaderSignature, directory64EndSignature, directoryEndSignature:
+			// the rest is read, so the command writing the stream doesn't fail.
+			_, err = io.Copy(io.Discard, stream)
+			return err
+		default:
+			return fmt.Errorf("failed to read local header at offset %d: %w", entryOffset, zip.ErrFormat)
+		}
+
+		entry, err := readStreamEntry(stream)
+		if err != nil {
+			return fmt.Errorf("failed to read local header at offset %d: %w", entryOffset, err)
+		}
+		if !entry.isStreamable() {
+			return u.unzipSpooled(stream, entryOffset, entry.raw())
+		}
+
+		unzip, err := u.prepareEntry(entry.zipEntry)
+		if err != nil {
+			return err
+		}
+		var extracted bool
+		if unzip {
+			extracted, err = u.unzipEntry(entry.zipEntry, entry.open)
+		}
+		drainErr := entry.drain()
+		if drainErr != nil {
+			return fmt.Errorf("failed to read zip entry '%s': %w", entry.zipEntry.Name, drainErr)
+		}
+		if err == nil && extracted {
+			err = entry.verify()
+		}
+		u.count(extracted, err)
+	}
+}
+
+// unzipSpooled spools the rest of the stream to a temp file and unzips the
+// entries from the given offset using the central directory.
+func (u *streamUnzipper) unzipSpooled(stream *streamReader, entryOffset int64, consumed []byte) error {
+	filePath, err := spoolStream(stream, entryOffset, consumed)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filePath)
+	u.opts.logf("spooled %s to %s from offset %d to read its central directory\n", stdinName, filePath, entryOffset)
+
+	zipReader, err := openZipFile(filePath, false)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	for _, zipEntry := range zipReader.File {
+		err = u.ctx.Err()
+		if err != nil {
+			return fmt.Errorf("context error: %w", err)
+		}
+		if zipEntry.HeaderOffset < entryOffset {
+			continue
+		}
+		unzip, err := u.prepareEntry(zipEntry)
+		if err != nil {
+			return err
+		}
+		if !unzip {
+			continue
+		}
+		u.count(u.unzipEntry(zipEntry, func() (io.ReadCloser, error) {
+			return openZipEntry(zipEntry, u.password)
+		}))
+	}
+	return nil
+}
+
+// prepareEntry decodes the name of an entry and reports whether to unzip it.
+// Insecure entries are skipped or rejected, since the stream isn't unzipped
+// this way when they are sanitized.
+func (u *streamUnzipper) prepareEntry(zipEntry *zip.File) (bool, error) {
+	files := []*zip.File{zipEntry}
+	decodedNames, err := decodeEntryNames(files, u.opts.nameEncoding)
+	if err != nil {
+		return false, fmt.Errorf("failed to read zip file '%s': %w", stdinName, err)
+	}
+	u.report.decodedNames = append(u.report.decodedNames, decodedNames...)
+	if u.opts.windowsPaths == windowsPathsNormalize {
+		normalizeWindowsPaths(files)
+	}
+	if isInsecurePath(zipEntry.Name) {
+		if u.opts.insecureEntries != insecureEntriesSkip {
+			return false, fmt.Errorf("insecure path '%s' found in zip file '%s'", zipEntry.Name, stdinName)
+		}
+		u.report.skippedNames = append(u.report.skippedNames, zipEntry.Name)
+		return false, nil
+	}
+	if !u.opts.filter.match(zipEntry) {
+		u.report.filtered++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (u *streamUnzipper) unzipEntry(zipEntry *zip.File, open func() (io.ReadCloser, error)) (bool, error) {
+	if zipEntry.FileInfo().IsDir() {
+		return true, createEntryDir(zipEntry, u.root, u.opts.modes)
+	}
+	zipEntryReader, err := open()
+	if err != nil {
+		return false, err
+	}
+	defer zipEntryReader.Close()
+	err = writeEntryFile(u.ctx, zipEntry, zipEntry.Name, zipEntryReader, u.root, u.opts, nil)
+	if err != nil {
+		return false, err
+	}
+	if u.opts.recursiveDepth > 0 {
+		u.nestedNames = append(u.nestedNames, filepath.FromSlash(zipEntry.Name))
+	}
+	return true, nil
+}
+
+func (u *streamUnzipper) count(extracted bool, err error) {
+	if err != nil {
+		u.report.failed++
+		u.errs = append(u.errs, err)
+		return
+	}
+	if extracted {
+		u.report.extracted++
+	}
+}
+
+func readStreamEntry(stream *streamReader) (*streamEntry, error) {
+	entry := &streamEntry{stream: stream, hash: crc32.NewIEEE()}
+	entry.header = make([]byte, localHeaderLen)
+	_, err := io.ReadFull(stream, entry.header)
+	if err != nil {
+		return nil, err
+	}
+	nameLen := int(binary.LittleEndian.Uint16(entry.header[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(entry.header[28:]))
+	data := make([]byte, nameLen+extraLen)
+	_, err = io.ReadFull(stream, data)
+	if err != nil {
+		return nil, err
+	}
+	entry.name = data[:nameLen]
+	entry.extra = data[nameLen:]
+	entry.isZip64, err = entry.readSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	entry.zipEntry = &zip.File{FileHeader: zip.FileHeader{
+		Name:               string(entry.name),
+		ReaderVersion:      binary.LittleEndian.Uint16(entry.header[4:]),
+		Flags:              entry.flags(),
+		Method:             binary.LittleEndian.Uint16(entry.header[8:]),
+		ModifiedTime:       binary.LittleEndian.Uint16(entry.header[10:]),
+		ModifiedDate:       binary.LittleEndian.Uint16(entry.header[12:]),
+		CRC32:              entry.crc32,
+		CompressedSize64:   entry.compressedSize,
+		UncompressedSize64: entry.uncompressedSize,
+		Extra:              entry.extra,
+	}}
+	entry.dataOffset = stream.offset
+	if !entry.hasUnknownSize() {
+		entry.data = &io.LimitedReader{R: stream, N: int64(entry.compressedSize)}
+	}
+	return entry, nil
+}
+
+func (e *streamEntry) raw() []byte {
+	return append(append(append([]byte{}, e.header...), e.name...), e.extra...)
+}
+
+func (e *streamEntry) hasUnknownSize() bool {
+	return e.hasDataDescriptor() && e.compressedSize == 0
+}
+
+// isStreamable reports whether the entry can be unzipped from the stream. The
+// end of an entry written without its sizes is only found for deflate, since
+// the deflate stream is self-terminating.
+func (e *streamEntry) isStreamable() bool {
+	if e.zipEntry.IsEncrypted() {
+		return false
+	}
+	return !e.hasUnknownSize() || e.zipEntry.Method == zip.Deflate
+}
+
+func (e *streamEntry) open() (io.ReadCloser, error) {
+	decompressor := findDecompressor(e.zipEntry.Method, e.zipEntry.UncompressedSize64)
+	if decompressor == nil {
+		return nil, makeUnsupportedMethodErr(e.zipEntry)
+	}
+	if e.data != nil {
+		e.reader = decompressor(e.data)
+	} else {
+		e.reader = decompressor(e.stream)
+	}
+	return io.NopCloser(e), nil
+}
+
+func (e *streamEntry) Read(p []byte) (int, error) {
+	n, err := e.reader.Read(p)
+	e.hash.Write(p[:n])
+	e.size += uint64(n)
+	if err == io.EOF {
+		e.ended = true
+	}
+	return n, err
+}
+
+// drain reads the rest of the entry and its data descriptor, so the stream is
+// at the next local header.
+func (e *streamEntry) drain() error {
+	if e.data != nil {
+		_, err := io.Copy(io.Discard, e.data)
+		if err == nil && e.data.N > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		if e.reader == nil {
+			e.reader = flate.NewReader(e.stream)
+		}
+		_, err := io.Copy(io.Discard, e)
+		if err != nil {
+			return err
+		}
+		e.compressedSize = uint64(e.stream.offset - e.dataOffset)
+	}
+	if e.reader != nil {
+		_ = e.reader.Close()
+	}
+	if !e.hasDataDescriptor() {
+		return nil
+	}
+	return e.readDataDescriptor()
+}
+
+func (e *streamEntry) readDataDescriptor() error {
+	signature, err := e.stream.reader.Peek(4)
+	if err == nil && binary.LittleEndian.Uint32(signature) == dataDescriptorSignature {
+		_, err = e.stream.reader.Discard(4)
+		e.stream.offset += 4
+	}
+	if err != nil {
+		return err
+	}
+	descriptor := make([]byte, 12)
+	if e.isZip64 {
+		descriptor = make([]byte, 20)
+	}
+	_, err = io.ReadFull(e.stream, descriptor)
+	if err != nil {
+		return err
+	}
+	if e.hasUnknownSize() || e.crc32 == 0 {
+		e.setDataDescriptor(descriptor, e.isZip64)
+	}
+	return nil
+}
+
+func (e *streamEntry) verify() error {
+	if !e.ended {
+		return nil
+	}
+	if e.size != e.uncompressedSize || e.hash.Sum32() != e.crc32 {
+		return fmt.Errorf("failed to unzip zip entry '%s': %w", e.zipEntry.Name, zip.ErrChecksum)
+	}
+	return nil
+}
+
+// spoolStream writes the rest of a stream to a temp file from the offset. The
+// bytes before the offset are already unzipped, so they are left as a hole to
+// keep the offsets of the central directory valid.
+func spoolStream(r io.Reader, offset int64, consumed []byte) (string, error) {
+	file, err := os.CreateTemp("", "biunzip-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err == nil {
+		_, err = file.Write(consumed)
+	}
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("failed to spool %s to temp file '%s': %w", stdinName, file.Name(), err)
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipStdin(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	expected := map[string]string{
+		"logs/system.evtx": "system",
+		"files/readme.txt": "readme",
+	}
+	tests := []struct {
+		name        string
+		password    string
+		createFile  func(t *testing.T, password string) string
+		opts        unzipOptions
+		expectedLog string
+	}{
+		{
+			name: "with deflated entries",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			opts: streamTestOpts(),
+		},
+		{
+			name:     "with encrypted entries",
+			password: "password_1",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			opts:        streamTestOpts(),
+			expectedLog: "spooled stdin to",
+		},
+		{
+			name:        "with stored entries",
+			createFile:  createStoredTestZipFile,
+			opts:        streamTestOpts(),
+			expectedLog: "from offset 0",
+		},
+		{
+			name: "with options requiring the central directory",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			opts: func() unzipOptions {
+				opts := streamTestOpts()
+				opts.portableNames = true
+				return opts
+			}(),
+			expectedLog: "to read its central directory",
+		},
+		{
+			name: "with the umask policy and rejected insecure entries",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			opts: unzipOptions{
+				modes:           modePolicy{policy: modePolicyUmask},
+				insecureEntries: insecureEntriesReject,
+			},
+		},
+		{
+			name: "with the preserve-safe policy",
+			createFile: func(t *testing.T, password string) string {
+				return createTestZipFile(t, entries, password)
+			},
+			opts: unzipOptions{
+				modes:           modePolicy{policy: modePolicyPreserveSafe},
+				insecureEntries: insecureEntriesReject,
+			},
+			expectedLog: "to read its central directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.createFile(t, tt.password))
+			require.NoError(t, err)
+			t.Chdir(t.TempDir())
+
+			logWriter := &bytes.Buffer{}
+			tt.opts.logWriter = logWriter
+			err = unzipStdin(context.Background(), bytes.NewReader(data), tt.password, tt.opts)
+			require.NoError(t, err)
+			requireDirContent(t, makeDirPath(stdinName), expected)
+			if len(tt.expectedLog) > 0 {
+				require.Contains(t, logWriter.String(), tt.expectedLog)
+			} else {
+				require.NotContains(t, logWriter.String(), "spooled")
+			}
+		})
+	}
+}
+
+func TestUnzipStdinWithCorruptedEntry(t *testing.T) {
+	entries := []testZipEntry{{name: "files/readme.txt", content: "readme"}}
+	data, err := os.ReadFile(createTestZipFile(t, entries, ""))
+	require.NoError(t, err)
+	// the entry is streamed, so its crc-32 is only read from the data
+	// descriptor after it.
+	descriptor := bytes.Index(data, []byte("PK\x07\x08"))
+	require.Positive(t, descriptor)
+	data[descriptor+4] ^= 0x01
+	t.Chdir(t.TempDir())
+
+	opts := streamTestOpts()
+	opts.logWriter = &bytes.Buffer{}
+	err = unzipStdin(context.Background(), bytes.NewReader(data), "", opts)
+	require.ErrorContains(t, err, "failed to unzip zip entry 'files/readme.txt'")
+}
+
+func TestUnzipStdinWithInsecureEntry(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "files/readme.txt", content: "readme"},
+		{name: "../outside.txt", content: "outside"},
+	}
+	data, err := os.ReadFile(createTestZipFile(t, entries, ""))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		insecureEntries string
+		expected        map[string]string
+		expectedErr     string
+		expectedLog     string
+	}{
+		{
+			name:            "with reject",
+			insecureEntries: insecureEntriesReject,
+			expected:        map[string]string{"files/readme.txt": "readme"},
+			expectedErr:     "insecure path '../outside.txt' found in zip file 'stdin'",
+		},
+		{
+			name:            "with skip",
+			insecureEntries: insecureEntriesSkip,
+			expected:        map[string]string{"files/readme.txt": "readme"},
+		},
+		{
+			name:            "with sanitize",
+			insecureEntries: insecureEntriesSanitize,
+			expected: map[string]string{
+				"files/readme.txt":      "readme",
+				"_insecure/outside.txt": "outside",
+				insecureMappingPath:     "Entry Name,Sanitized Name\n../outside.txt,_insecure/outside.txt\n",
+			},
+			expectedLog: "to read its central directory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			logWriter := &bytes.Buffer{}
+			opts := streamTestOpts()
+			opts.insecureEntries = tt.insecureEntries
+			opts.logWriter = logWriter
+			err := unzipStdin(context.Background(), bytes.NewReader(data), "", opts)
+			if len(tt.expectedErr) > 0 {
+				require.ErrorContains(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			requireDirContent(t, makeDirPath(stdinName), tt.expected)
+			if len(tt.expectedLog) > 0 {
+				require.Contains(t, logWriter.String(), tt.expectedLog)
+			} else {
+				require.NotContains(t, logWriter.String(), "spooled")
+			}
+		})
+	}
+}
+
+func TestUnzipStdinWithInvalidStream(t *testing.T) {
+	t.Chdir(t.TempDir())
+	opts := streamTestOpts()
+	opts.logWriter = &bytes.Buffer{}
+	err := unzipStdin(context.Background(), bytes.NewReader([]byte("not a zip file")), "", opts)
+	require.ErrorContains(t, err, "failed to read local header at offset 0")
+}
+
+// streamTestOpts returns the options unzipping the entries while the stream
+// is read.
+func streamTestOpts() unzipOptions {
+	return unzipOptions{
+		modes:           modePolicy{policy: modePolicyFixed, fileMode: defaultFileMode, dirMode: defaultDirMode},
+		insecureEntries: insecureEntriesSkip,
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	symlinksSkip   = "skip"
+	symlinksFile   = "file"
+	symlinksCreate = "create"
+
+	maxSymlinkTargetSize = 4096
+)
+
+var (
+	errInvalidSymlinksMode = errors.New("invalid symlinks mode. valid modes are skip, file and create")
+	errSymlinkTargetSize   = errors.New("symlink target is too long")
+)
+
+func validateSymlinksMode(mode string) error {
+	switch mode {
+	case symlinksSkip, symlinksFile, symlinksCreate:
+		return nil
+	}
+	return errInvalidSymlinksMode
+}
+
+func isSymlink(zipEntry *zip.File) bool {
+	return zipEntry.Mode()&os.ModeSymlink != 0
+}
+
+// moveSymlinksLast keeps the order of the entries but moves the symlinks to
+// the end, so no entry is written through a symlink created from the same
+// zip file.
+func moveSymlinksLast(files []*zip.File) []*zip.File {
+	sorted := make([]*zip.File, 0, len(files))
+	var symlinks []*zip.File
+	for _, file := range files {
+		if isSymlink(file) {
+			symlinks = append(symlinks, file)
+			continue
+		}
+		sorted = append(sorted, file)
+	}
+	return append(sorted, symlinks...)
+}
+
+func createSymlink(zipEntry *zip.File, root *os.Root, password string, modes modePolicy) error {
+	target, err := readSymlinkTarget(zipEntry, password)
+	if err != nil {
+		return err
+	}
+	err = validateSymlinkTarget(zipEntry.Name, target)
+	if err != nil {
+		return err
+	}
+	// the target is validated against the symlink's dir, so the dir itself
+	// can't be reached through another symlink.
+	name := filepath.FromSlash(zipEntry.Name)
+	if hasSymlinkParent(root, name) {
+		return fmt.Errorf("symlink '%s' is inside another symlink", zipEntry.Name)
+	}
+	_ = root.MkdirAll(filepath.Dir(name), modes.entryDirMode(nil))
+	err = root.Symlink(filepath.FromSlash(target), name)
+	if err != nil {
+		return fmt.Errorf("failed to create symlink '%s': %w", filepath.Join(root.Name(), name), err)
+	}
+	return modes.applyEntryMode(root, name, zipEntry)
+}
+
+func readSymlinkTarget(zipEntry *zip.File, password string) (string, error) {
+	zipEntryReader, err := openZipEntry(zipEntry, password)
+	if err != nil {
+		return "", err
+	}
+	defer zipEntryReader.Close()
+	target, err := io.ReadAll(io.LimitReader(zipEntryReader, maxSymlinkTargetSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read symlink target of zip entry '%s': %w", zipEntry.Name, err)
+	}
+	if len(target) > maxSymlinkTargetSize {
+		return "", fmt.Errorf("failed to read symlink target of zip entry '%s': %w", zipEntry.Name, errSymlinkTargetSize)
+	}
+	return string(target), nil
+}
+
+// validateSymlinkTarget allows only relative targets staying in the zip
+// file's dir. Parent dir elements are allowed only at the start of the
+// target, since a parent dir after a symlink is resolved from the symlink's
+// target instead of its own dir.
+func validateSymlinkTarget(name string, target string) error {
+	target = strings.ReplaceAll(target, `\`, "/")
+	if len(target) == 0 || strings.HasPrefix(target, "/") || hasDrivePrefix(target) {
+		return fmt.Errorf("symlink '%s' has an insecure target '%s'", name, target)
+	}
+	parentCount := 0
+	for i, elem := range strings.Split(target, "/") {
+		if elem != ".." {
+			continue
+		}
+		if i != parentCount {
+			return fmt.Errorf("symlink '%s' has an insecure target '%s'", name, target)
+		}
+		parentCount++
+	}
+	resolved := filepath.Join(filepath.Dir(filepath.FromSlash(name)), filepath.FromSlash(target))
+	if !filepath.IsLocal(resolved) && resolved != "." {
+		return fmt.Errorf("symlink '%s' has an insecure target '%s'", name, target)
+	}
+	return nil
+}
+
+func hasSymlinkParent(root *os.Root, name string) bool {
+	parentPath := ""
+	for _, elem := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		parentPath = filepath.Join(parentPath, elem)
+		info, err := root.Lstat(parentPath)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/binalyze/biunzip/internal/zip"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnzipFileWithSymlinks(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "link_1", content: "dir_1/file_1.txt", mode: os.ModeSymlink | 0777},
+		{name: "dir_1/file_1.txt", content: "content_1"},
+		{name: "dir_1/link_2", content: "../../outside.txt", mode: os.ModeSymlink | 0777},
+	}
+	tests := []struct {
+		name      string
+		symlinks  string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "with skip",
+			symlinks: symlinksSkip,
+			expected: map[string]string{
+				"dir_1/file_1.txt": "content_1",
+			},
+		},
+		{
+			name:     "with file",
+			symlinks: symlinksFile,
+			expected: map[string]string{
+				"link_1":           "dir_1/file_1.txt",
+				"dir_1/file_1.txt": "content_1",
+				"dir_1/link_2":     "../../outside.txt",
+			},
+		},
+		{
+			name:     "with create",
+			symlinks: symlinksCreate,
+			expected: map[string]string{
+				"link_1":           "content_1",
+				"dir_1/file_1.txt": "content_1",
+			},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.symlinks == symlinksCreate {
+				skipWithoutSymlinks(t)
+			}
+			filePath := createTestZipFile(t, entries, "")
+			opts := unzipOptions{
+				symlinks: tt.symlinks,
+			}
+			err := unzipFile(context.Background(), filePath, "", opts)
+			if tt.expectErr {
+				require.ErrorContains(t, err, "symlink 'dir_1/link_2' has an insecure target")
+			} else {
+				require.NoError(t, err)
+			}
+			requireDirContent(t, makeDirPath(filePath), tt.expected)
+			if tt.symlinks == symlinksCreate {
+				target, err := os.Readlink(filepath.Join(makeDirPath(filePath), "link_1"))
+				require.NoError(t, err)
+				require.Equal(t, "dir_1/file_1.txt", target)
+			}
+		})
+	}
+}
+
+func TestUnzipFileWithSymlinkParent(t *testing.T) {
+	skipWithoutSymlinks(t)
+	entries := []testZipEntry{
+		{name: "dir_1/"},
+		{name: "link_1", content: ".", mode: os.ModeSymlink | 0777},
+		{name: "link_1/link_2", content: "../outside.txt", mode: os.ModeSymlink | 0777},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	opts := unzipOptions{
+		symlinks: symlinksCreate,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.ErrorContains(t, err, "symlink 'link_1/link_2' is inside another symlink")
+	require.NoFileExists(t, filepath.Join(makeDirPath(filePath), "link_2"))
+}
+
+func TestExtractToTarWithSymlinks(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "link_1", content: "file_1.txt", mode: os.ModeSymlink | 0777},
+		{name: "file_1.txt", content: "content_1"},
+	}
+	tests := []struct {
+		name     string
+		symlinks string
+		expected map[string]string
+	}{
+		{
+			name:     "with file",
+			symlinks: symlinksFile,
+			expected: map[string]string{
+				"test/link_1":     "file_1.txt",
+				"test/file_1.txt": "content_1",
+			},
+		},
+		{
+			name:     "with create",
+			symlinks: symlinksCreate,
+			expected: map[string]string{
+				"test/file_1.txt": "content_1",
+				"test/link_1":     "-> file_1.txt",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := createTestZipFile(t, entries, "")
+			tarPath := filepath.Join(t.TempDir(), "test.tar")
+			opts := unzipOptions{
+				symlinks: tt.symlinks,
+			}
+			err := extractToTar(context.Background(), tarPath, []string{filePath}, "", opts)
+			require.NoError(t, err)
+
+			tarFile, err := os.Open(tarPath)
+			require.NoError(t, err)
+			defer tarFile.Close()
+			actual := make(map[string]string)
+			tarReader := tar.NewReader(tarFile)
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				if header.Typeflag == tar.TypeSymlink {
+					actual[header.Name] = "-> " + header.Linkname
+					continue
+				}
+				content, err := io.ReadAll(tarReader)
+				require.NoError(t, err)
+				actual[header.Name] = string(content)
+			}
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestMoveSymlinksLast(t *testing.T) {
+	files := []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "link_1"}},
+		{FileHeader: zip.FileHeader{Name: "file_1.txt"}},
+		{FileHeader: zip.FileHeader{Name: "link_2"}},
+		{FileHeader: zip.FileHeader{Name: "file_2.txt"}},
+	}
+	files[0].SetMode(os.ModeSymlink | 0777)
+	files[2].SetMode(os.ModeSymlink | 0777)
+	actual := moveSymlinksLast(files)
+	names := make([]string, 0, len(actual))
+	for _, file := range actual {
+		names = append(names, file.Name)
+	}
+	require.Equal(t, []string{"file_1.txt", "file_2.txt", "link_1", "link_2"}, names)
+}
+
+func TestValidateSymlinkTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		entryName string
+		target    string
+		expectErr bool
+	}{
+		{
+			name:      "with a sibling target",
+			entryName: "dir_1/link_1",
+			target:    "file_1.txt",
+		},
+		{
+			name:      "with a parent dir target",
+			entryName: "dir_1/link_1",
+			target:    "../dir_2/file_1.txt",
+		},
+		{
+			name:      "with the root target",
+			entryName: "dir_1/link_1",
+			target:    "..",
+		},
+		{
+			name:      "with an outside target",
+			entryName: "dir_1/link_1",
+			target:    "../../file_1.txt",
+			expectErr: true,
+		},
+		{
+			name:      "with an absolute target",
+			entryName: "link_1",
+			target:    "/etc/passwd",
+			expectErr: true,
+		},
+		{
+			name:      "with a drive target",
+			entryName: "link_1",
+			target:    `C:\Windows`,
+			expectErr: true,
+		},
+		{
+			name:      "with a parent dir after a name",
+			entryName: "link_1",
+			target:    "link_2/../file_1.txt",
+			expectErr: true,
+		},
+		{
+			name:      "with an empty target",
+			entryName: "link_1",
+			target:    "",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSymlinkTarget(tt.entryName, tt.target)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func skipWithoutSymlinks(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires extra privileges on windows")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func extractToTar(ctx context.Context, tarPath string, filePaths []string, password string, opts unzipOptions) error {
+	err := validateTarOptions(opts)
+	if err != nil {
+		return err
+	}
+	prefixes, err := makeTarPrefixes(filePaths)
+	if err != nil {
+		return err
+	}
+
+	var output io.Writer = os.Stdout
+	if tarPath != "-" {
+		file, err := os.OpenFile(tarPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) // 0644: rw-r--r--
+		if err != nil {
+			return fmt.Errorf("failed to create tar file: %w", err)
+		}
+		defer file.Close()
+		output = file
+	}
+	bufWriter := bufio.NewWriterSize(output, defaultBufSize)
+	tarWriter := tar.NewWriter(bufWriter)
+
+	var errs []error
+	for i, filePath := range filePaths {
+		report, err := walkZipFile(ctx, newZipSource(filePath), opts, func(zipEntry *zip.File, _ string) error {
+			return writeTarEntry(ctx, tarWriter, zipEntry, prefixes[i], password, opts)
+		})
+		opts.logReport(report)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(report.sanitizedNames) > 0 {
+			err = writeTarMapping(tarWriter, prefixes[i], report.sanitizedNames)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	err = tarWriter.Close()
+	if err == nil {
+		err = bufWriter.Flush()
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to write tar stream: %w", err))
+	}
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	return nil
+}
+
+// validateTarOptions rejects the options which only apply to unzipping to the
+// disk, instead of ignoring them.
+func validateTarOptions(opts unzipOptions) error {
+	var flags []string
+	if opts.recursiveDepth > 0 {
+		flags = append(flags, "--recursive-archives")
+	}
+	if opts.seal {
+		flags = append(flags, "--seal")
+	}
+	if opts.xattrs {
+		flags = append(flags, "--xattrs")
+	}
+	if len(flags) > 0 {
+		return fmt.Errorf("%s can't be used with --to-tar", strings.Join(flags, ", "))
+	}
+	return nil
+}
+
+func makeTarPrefixes(filePaths []string) ([]string, error) {
+	prefixes := make([]string, 0, len(filePaths))
+	seen := make(map[string]string, len(filePaths))
+	for _, filePath := range filePaths {
+		prefix := filepath.Base(makeDirPath(filePath))
+		existingFilePath, ok := seen[prefix]
+		if ok {
+			return nil, fmt.Errorf("zip files '%s' and '%s' have the same name", existingFilePath, filePath)
+		}
+		seen[prefix] = filePath
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+func writeTarMapping(tarWriter *tar.Writer, prefix string, sanitizedNames []sanitizedName) error {
+	data, err := makeInsecureMapping(sanitizedNames)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(prefix, insecureMappingPath),
+		Size:     int64(len(data)),
+		Mode:     0644, // 0644: rw-r--r--
+		ModTime:  time.Now(),
+		Format:   tar.FormatPAX,
+	}
+	err = tarWriter.WriteHeader(header)
+	if err == nil {
+		_, err = tarWriter.Write(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write insecure entry mapping to tar stream: %w", err)
+	}
+	return nil
+}
+
+func writeTarEntry(ctx context.Context, tarWriter *tar.Writer, zipEntry *zip.File, prefix string, password string, opts unzipOptions) error {
+	header, err := tar.FileInfoHeader(zipEntry.FileInfo(), "")
+	if err != nil {
+		return fmt.Errorf("failed to create tar header for zip entry '%s': %w", zipEntry.Name, err)
+	}
+	header.Name = path.Join(prefix, zipEntry.Name)
+	header.Format = tar.FormatPAX
+	header.Mode = int64(opts.modes.entryFileMode(zipEntry))
+	if zipEntry.FileInfo().IsDir() {
+		header.Mode = int64(opts.modes.entryDirMode(zipEntry))
+	}
+	if opts.modes.restoreOwner {
+		header.Uid, header.Gid, _ = findUnixOwner(&zipEntry.FileHeader)
+	}
+
+	if zipEntry.FileInfo().IsDir() {
+		header.Name += "/"
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to write tar header for zip entry '%s': %w", zipEntry.Name, err)
+		}
+		return nil
+	}
+
+	if isSymlink(zipEntry) {
+		if opts.symlinks == symlinksCreate {
+			return writeTarSymlink(tarWriter, zipEntry, header, password)
+		}
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(zipEntry.UncompressedSize64)
+	}
+
+	zipEntryReader, err := openZipEntry(zipEntry, password)
+	if err != nil {
+		return err
+	}
+	defer zipEntryReader.Close()
+
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write tar header for zip entry '%s': %w", zipEntry.Name, err)
+	}
+	written, err := io.Copy(tarWriter, newProgressReader(newContextReader(ctx, zipEntryReader), zipEntry, opts))
+	if err == nil && written < header.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		// the header is already written, so the entry is padded to keep the
+		// tar stream valid for the following entries.
+		_, _ = io.CopyN(tarWriter, zeroReader{}, header.Size-written)
+		return fmt.Errorf("failed to copy zip entry '%s' to tar stream, the entry is incomplete: %w", zipEntry.Name, err)
+	}
+	return nil
+}
+
+func writeTarSymlink(tarWriter *tar.Writer, zipEntry *zip.File, header *tar.Header, password string) error {
+	target, err := readSymlinkTarget(zipEntry, password)
+	if err != nil {
+		return err
+	}
+	err = validateSymlinkTarget(zipEntry.Name, target)
+	if err != nil {
+		return err
+	}
+	header.Linkname = strings.ReplaceAll(target, `\`, "/")
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write tar header for zip entry '%s': %w", zipEntry.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractToTar(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "logs/"},
+		{name: "logs/system.evtx", content: "system"},
+		{name: "files/readme.txt", content: "readme"},
+	}
+	filePath := createTestZipFile(t, entries, "password_1")
+	tarPath := filepath.Join(t.TempDir(), "test.tar")
+
+	opts := unzipOptions{
+		filter: entryFilter{excludes: []string{"files"}},
+	}
+	err := extractToTar(context.Background(), tarPath, []string{filePath}, "password_1", opts)
+	require.NoError(t, err)
+
+	tarFile, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer tarFile.Close()
+
+	type tarEntry struct {
+		mode    int64
+		content string
+	}
+	expected := map[string]tarEntry{
+		"test/logs/":            {mode: 0755},
+		"test/logs/system.evtx": {mode: 0644, content: "system"},
+	}
+	actual := make(map[string]tarEntry)
+	tarReader := tar.NewReader(tarFile)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		actual[header.Name] = tarEntry{mode: header.Mode & 0777, content: string(content)}
+	}
+	require.Equal(t, expected, actual)
+
+	err = extractToTar(context.Background(), tarPath, []string{filePath}, "password_1", opts)
+	require.Error(t, err, "existing tar file must not be overwritten")
+}
+
+func TestValidateTarOptions(t *testing.T) {
+	require.NoError(t, validateTarOptions(unzipOptions{}))
+	require.EqualError(t, validateTarOptions(unzipOptions{seal: true}), "--seal can't be used with --to-tar")
+	err := validateTarOptions(unzipOptions{recursiveDepth: 1, xattrs: true})
+	require.EqualError(t, err, "--recursive-archives, --xattrs can't be used with --to-tar")
+}
+
+func TestMakeTarPrefixes(t *testing.T) {
+	actual, err := makeTarPrefixes([]string{"/tmp/file_1.zip", "/tmp/dir/file_2.zip"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"file_1", "file_2"}, actual)
+
+	_, err = makeTarPrefixes([]string{"/tmp/file_1.zip", "/tmp/dir/file_1.zip"})
+	require.Error(t, err)
+}
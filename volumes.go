@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const (
+	directoryEndLen          = 22
+	directoryEndMaxLen       = directoryEndLen + math.MaxUint16
+	directory64LocLen        = 20
+	directory64EndLen        = 56
+	directoryHeaderLen       = 46
+	directoryEndSignature    = 0x06054b50
+	directory64LocSignature  = 0x07064b50
+	directory64EndSignature  = 0x06064b50
+	directoryHeaderSignature = 0x02014b50
+)
+
+var (
+	// 7-Zip splits a zip file into segments named .zip.001, .zip.002 and so
+	// on, which are concatenated without changing the offsets.
+	splitSegmentPattern = regexp.MustCompile(`(?i)\.zip\.(\d{3})$`)
+
+	errDirectoryEndNotFound = errors.New("end of central directory not found")
+	errInvalidVolumeNumber  = errors.New("invalid volume number")
+	errSplitZipTooLarge     = errors.New("split zip file without zip64 is larger than 4GB")
+)
+
+// volumeReader presents the volumes of a split zip file as a single zip file.
+// PKZIP and Info-ZIP split a zip file into volumes named .z01, .z02 and so on
+// with the last one named .zip, where the offsets are relative to the volume,
+// so the offsets of the central directory are patched to be absolute.
+type volumeReader struct {
+	readers         []io.ReaderAt
+	files           []*os.File
+	starts          []int64
+	size            int64
+	spanned         bool
+	patches         []volumePatch
+	directoryOffset int64
+}
+
+type volumePatch struct {
+	offset int64
+	data   []byte
+}
+
+func openVolumes(filePath string) (*volumeReader, error) {
+	paths, spanned, err := findVolumePaths(filePath)
+	if err != nil {
+		return nil, err
+	}
+	reader := &volumeReader{spanned: spanned}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			_ = reader.Close()
+			return nil, err
+		}
+		reader.files = append(reader.files, file)
+		reader.readers = append(reader.readers, file)
+		fileInfo, err := file.Stat()
+		if err != nil {
+			_ = reader.Close()
+			return nil, err
+		}
+		reader.starts = append(reader.starts, reader.size)
+		reader.size += fileInfo.Size()
+	}
+	if spanned {
+		err = reader.patchDirectoryEnd()
+		if err != nil {
+			_ = reader.Close()
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+// newReaderVolumes presents a zip file opened by the caller, e.g. a nested
+// archive, as a zip file without volumes. Closing it doesn't close the reader.
+func newReaderVolumes(r io.ReaderAt, size int64) *volumeReader {
+	return &volumeReader{
+		readers: []io.ReaderAt{r},
+		starts:  []int64{0},
+		size:    size,
+	}
+}
+
+func findVolumePaths(filePath string) ([]string, bool, error) {
+	if match := splitSegmentPattern.FindStringSubmatch(filePath); match != nil {
+		paths, err := findSplitSegmentPaths(filePath[:len(filePath)-len(match[1])], match[1])
+		return paths, false, err
+	}
+	if !strings.EqualFold(filepath.Ext(filePath), ".zip") {
+		return []string{filePath}, false, nil
+	}
+	// x.zip becomes x.z01 keeping the case of the extension.
+	prefix := filePath[:len(filePath)-2]
+	_, err := os.Stat(prefix + "01")
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{filePath}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	lastDisk, err := readLastDiskNumber(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	var paths []string
+	for disk := 1; disk <= lastDisk; disk++ {
+		path := fmt.Sprintf("%s%02d", prefix, disk)
+		_, err = os.Stat(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("volume '%s' of split zip file is missing: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return append(paths, filePath), true, nil
+}
+
+// findSplitSegmentPaths finds the segments up to the given one and the ones
+// following it.
+func findSplitSegmentPaths(prefix string, segment string) ([]string, error) {
+	last, _ := strconv.Atoi(segment)
+	var paths []string
+	for i := 1; ; i++ {
+		path := fmt.Sprintf("%s%03d", prefix, i)
+		_, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) && i > last {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("volume '%s' of split zip file is missing: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func readLastDiskNumber(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	endOffset, end, err := findDirectoryEnd(file, fileInfo.Size())
+	if err != nil {
+		return 0, err
+	}
+	disk := binary.LittleEndian.Uint16(end[4:])
+	if disk != math.MaxUint16 {
+		return int(disk), nil
+	}
+	// the disk number doesn't fit in the end of central directory of a zip64
+	// zip file, and the zip64 end of central directory locator before it has
+	// the number of disks.
+	loc := make([]byte, directory64LocLen)
+	_, err = file.ReadAt(loc, endOffset-directory64LocLen)
+	if err != nil || binary.LittleEndian.Uint32(loc) != directory64LocSignature {
+		return 0, zip.ErrFormat
+	}
+	disks := binary.LittleEndian.Uint32(loc[16:])
+	if disks == 0 || disks > math.MaxInt32 {
+		return 0, zip.ErrFormat
+	}
+	return int(disks - 1), nil
+}
+
+func findDirectoryEnd(r io.ReaderAt, size int64) (int64, []byte, error) {
+	bufSize := min(size, directoryEndMaxLen)
+	buf := make([]byte, bufSize)
+	_, err := r.ReadAt(buf, size-bufSize)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	for i := len(buf) - directoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != directoryEndSignature {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(buf[i+directoryEndLen-2:]))
+		if i+directoryEndLen+commentLen <= len(buf) {
+			return size - bufSize + int64(i), buf[i : i+directoryEndLen], nil
+		}
+	}
+	return 0, nil, errDirectoryEndNotFound
+}
+
+// findPrependedLen finds the length of the data prepended to a zip file
+// without updating the offsets of its central directory, e.g. a
+// self-extractor stub concatenated with a zip file. It is 0 for zip64 zip
+// files, whose zip64 end of central directory can't be found then.
+func findPrependedLen(r io.ReaderAt, size int64) int64 {
+	endOffset, end, err := findDirectoryEnd(r, size)
+	if err != nil {
+		return 0
+	}
+	dirSize := int64(binary.LittleEndian.Uint32(end[12:]))
+	dirOffset := int64(binary.LittleEndian.Uint32(end[16:]))
+	if dirOffset == math.MaxUint32 {
+		return 0
+	}
+	return max(endOffset-dirSize-dirOffset, 0)
+}
+
+func (r *volumeReader) patchDirectoryEnd() error {
+	endOffset, end, err := findDirectoryEnd(r, r.size)
+	if err != nil {
+		return err
+	}
+	dirOffset := binary.LittleEndian.Uint32(end[16:])
+	if dirOffset != math.MaxUint32 {
+		r.directoryOffset, err = r.absoluteOffset(uint32(binary.LittleEndian.Uint16(end[6:])), uint64(dirOffset))
+		if err != nil {
+			return err
+		}
+		if r.directoryOffset > math.MaxUint32 {
+			return errSplitZipTooLarge
+		}
+		r.patches = append(r.patches, volumePatch{offset: endOffset + 16, data: binary.LittleEndian.AppendUint32(nil, uint32(r.directoryOffset))})
+		return nil
+	}
+
+	locOffset := endOffset - directory64LocLen
+	loc := make([]byte, directory64LocLen)
+	_, err = r.ReadAt(loc, locOffset)
+	if err != nil || binary.LittleEndian.Uint32(loc) != directory64LocSignature {
+		return zip.ErrFormat
+	}
+	end64Offset, err := r.absoluteOffset(binary.LittleEndian.Uint32(loc[4:]), binary.LittleEndian.Uint64(loc[8:]))
+	if err != nil {
+		return err
+	}
+	end64 := make([]byte, directory64EndLen)
+	_, err = r.ReadAt(end64, end64Offset)
+	if err != nil || binary.LittleEndian.Uint32(end64) != directory64EndSignature {
+		return zip.ErrFormat
+	}
+	r.directoryOffset, err = r.absoluteOffset(binary.LittleEndian.Uint32(end64[20:]), binary.LittleEndian.Uint64(end64[48:]))
+	if err != nil {
+		return err
+	}
+	r.patches = append(r.patches,
+		volumePatch{offset: locOffset + 8, data: binary.LittleEndian.AppendUint64(nil, uint64(end64Offset))},
+		volumePatch{offset: end64Offset + 48, data: binary.LittleEndian.AppendUint64(nil, uint64(r.directoryOffset))},
+	)
+	return nil
+}
+
+// fixEntryOffsets adds the start of the volumes to the local header offsets
+// of the entries, since the zip package ignores the volume numbers.
+func (r *volumeReader) fixEntryOffsets(files []*zip.File) error {
+	if !r.spanned {
+		return nil
+	}
+	dirReader := bufio.NewReader(io.NewSectionReader(r, r.directoryOffset, r.size-r.directoryOffset))
+	header := make([]byte, directoryHeaderLen)
+	for _, file := range files {
+		_, err := io.ReadFull(dirReader, header)
+		if err != nil || binary.LittleEndian.Uint32(header) != directoryHeaderSignature {
+			return zip.ErrFormat
+		}
+		nameLen := int(binary.LittleEndian.Uint16(header[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(header[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(header[32:]))
+		data := make([]byte, nameLen+extraLen+commentLen)
+		_, err = io.ReadFull(dirReader, data)
+		if err != nil {
+			return zip.ErrFormat
+		}
+		disk, err := readEntryDiskNumber(header, data[nameLen:nameLen+extraLen])
+		if err != nil {
+			return fmt.Errorf("failed to read zip entry '%s': %w", file.Name, err)
+		}
+		offset, err := r.absoluteOffset(disk, uint64(file.HeaderOffset))
+		if err != nil {
+			return fmt.Errorf("failed to read zip entry '%s': %w", file.Name, err)
+		}
+		file.HeaderOffset = offset
+	}
+	return nil
+}
+
+// readEntryDiskNumber reads the volume number of the local header, which is
+// stored after the zip64 sizes and offset if it doesn't fit in 16 bits.
+func readEntryDiskNumber(header []byte, extra []byte) (uint32, error) {
+	disk := binary.LittleEndian.Uint16(header[34:])
+	if disk != math.MaxUint16 {
+		return uint32(disk), nil
+	}
+	data, _ := findExtraField(extra, zip64ExtraID)
+	for _, offset := range []int{24, 20, 42} {
+		if binary.LittleEndian.Uint32(header[offset:]) == math.MaxUint32 {
+			if len(data) < 8 {
+				return 0, errInvalidZip64Extra
+			}
+			data = data[8:]
+		}
+	}
+	if len(data) < 4 {
+		return 0, errInvalidZip64Extra
+	}
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+func (r *volumeReader) absoluteOffset(disk uint32, offset uint64) (int64, error) {
+	if int(disk) >= len(r.starts) || offset > uint64(r.size) {
+		return 0, errInvalidVolumeNumber
+	}
+	return r.starts[disk] + int64(offset), nil
+}
+
+func (r *volumeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > pos }) - 1
+		volumeEnd := r.size
+		if i+1 < len(r.starts) {
+			volumeEnd = r.starts[i+1]
+		}
+		limit := min(int64(len(p)-n), volumeEnd-pos)
+		read, err := r.readers[i].ReadAt(p[n:n+int(limit)], pos-r.starts[i])
+		n += read
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if read == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	r.applyPatches(p[:n], off)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *volumeReader) applyPatches(p []byte, off int64) {
+	for _, patch := range r.patches {
+		for i, b := range patch.data {
+			pos := patch.offset + int64(i) - off
+			if pos >= 0 && pos < int64(len(p)) {
+				p[pos] = b
+			}
+		}
+	}
+}
+
+func (r *volumeReader) Close() error {
+	var errs []error
+	for _, file := range r.files {
+		err := file.Close()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return joinMultiErrs(errs)
+	}
+	return nil
+}
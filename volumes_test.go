@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testVolumeEntries = []testZipEntry{
+	{name: "logs/system.evtx", content: "system"},
+	{name: "logs/security.evtx", content: "security"},
+	{name: "files/readme.txt", content: "readme"},
+}
+
+func TestUnzipFileWithSplitVolumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		createFile  func(t *testing.T) (string, []string)
+		volumeIndex int
+	}{
+		{
+			name:        "with segments named by the first segment",
+			createFile:  createSegmentedTestZipFile,
+			volumeIndex: 0,
+		},
+		{
+			name:        "with segments named by the last segment",
+			createFile:  createSegmentedTestZipFile,
+			volumeIndex: 2,
+		},
+		{
+			name:        "with spanned volumes",
+			createFile:  createSpannedTestZipFile,
+			volumeIndex: 2,
+		},
+		{
+			name:        "with zip64 spanned volumes",
+			createFile:  createSpannedZip64TestZipFile,
+			volumeIndex: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, volumePaths := tt.createFile(t)
+			filePath := volumePaths[tt.volumeIndex]
+			err := unzipFile(context.Background(), filePath, "", unzipOptions{logWriter: &bytes.Buffer{}})
+			require.NoError(t, err)
+			requireDirContent(t, makeDirPath(filePath), map[string]string{
+				"logs/system.evtx":   "system",
+				"logs/security.evtx": "security",
+				"files/readme.txt":   "readme",
+			})
+		})
+	}
+}
+
+func TestUnzipFileWithMissingVolumes(t *testing.T) {
+	tests := []struct {
+		name         string
+		createFile   func(t *testing.T) (string, []string)
+		missingIndex int
+	}{
+		{
+			name:         "with a missing segment",
+			createFile:   createSegmentedTestZipFile,
+			missingIndex: 1,
+		},
+		{
+			name:         "with a missing spanned volume",
+			createFile:   createSpannedTestZipFile,
+			missingIndex: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, volumePaths := tt.createFile(t)
+			missingPath := volumePaths[tt.missingIndex]
+			require.NoError(t, os.Remove(missingPath))
+
+			err := unzipFile(context.Background(), volumePaths[2], "", unzipOptions{logWriter: &bytes.Buffer{}})
+			require.ErrorContains(t, err, fmt.Sprintf("volume '%s' of split zip file is missing", missingPath))
+
+			err = validateZipFile(zipFile{path: volumePaths[2]})
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+	}
+}
+
+func TestIsLastSplitSegment(t *testing.T) {
+	_, volumePaths := createSegmentedTestZipFile(t)
+	require.False(t, isLastSplitSegment(volumePaths[0]))
+	require.True(t, isLastSplitSegment(volumePaths[2]))
+	require.False(t, isLastSplitSegment("test.zip"))
+}
+
+// createSegmentedTestZipFile splits a zip file into 3 segments named
+// .zip.001, .zip.002 and .zip.003.
+func createSegmentedTestZipFile(t *testing.T) (string, []string) {
+	t.Helper()
+	filePath := createTestZipFile(t, testVolumeEntries, "")
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filePath))
+
+	segmentSize := len(data)/3 + 1
+	var paths []string
+	for i := range 3 {
+		path := fmt.Sprintf("%s.%03d", filePath, i+1)
+		segment := data[min(i*segmentSize, len(data)):min((i+1)*segmentSize, len(data))]
+		require.NoError(t, os.WriteFile(path, segment, 0644))
+		paths = append(paths, path)
+	}
+	return filePath, paths
+}
+
+// createSpannedTestZipFile splits a zip file into 3 volumes named .z01, .z02
+// and .zip the way PKZIP and Info-ZIP do, so the offsets in the central
+// directory are relative to the volumes.
+func createSpannedTestZipFile(t *testing.T) (string, []string) {
+	t.Helper()
+	return createSpannedTestZipFileWithEnd(t, false)
+}
+
+// createSpannedZip64TestZipFile splits a zip file into 3 volumes like
+// createSpannedTestZipFile, with a zip64 end of central directory whose disk
+// numbers don't fit in the end of central directory.
+func createSpannedZip64TestZipFile(t *testing.T) (string, []string) {
+	t.Helper()
+	return createSpannedTestZipFileWithEnd(t, true)
+}
+
+func createSpannedTestZipFileWithEnd(t *testing.T, zip64 bool) (string, []string) {
+	t.Helper()
+	filePath := createTestZipFile(t, testVolumeEntries, "")
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	data = append([]byte{0x50, 0x4b, 0x07, 0x08}, data...)
+
+	endOffset := bytes.LastIndex(data, []byte{0x50, 0x4b, 0x05, 0x06})
+	volumeSize := endOffset/3 + 1
+	toVolume := func(offset int) (int, int) {
+		disk := min(offset/volumeSize, 2)
+		return disk, offset - disk*volumeSize
+	}
+
+	records := int(binary.LittleEndian.Uint16(data[endOffset+10:]))
+	dirSize := int(binary.LittleEndian.Uint32(data[endOffset+12:]))
+	dirOffset := int(binary.LittleEndian.Uint32(data[endOffset+16:])) + 4
+	offset := dirOffset
+	for range records {
+		disk, headerOffset := toVolume(int(binary.LittleEndian.Uint32(data[offset+42:])) + 4)
+		binary.LittleEndian.PutUint16(data[offset+34:], uint16(disk))
+		binary.LittleEndian.PutUint32(data[offset+42:], uint32(headerOffset))
+		nameLen := int(binary.LittleEndian.Uint16(data[offset+28:]))
+		extraLen := int(binary.LittleEndian.Uint16(data[offset+30:]))
+		commentLen := int(binary.LittleEndian.Uint16(data[offset+32:]))
+		offset += directoryHeaderLen + nameLen + extraLen + commentLen
+	}
+	dirDisk, dirOffset := toVolume(dirOffset)
+	if zip64 {
+		end64Disk, end64Offset := toVolume(endOffset)
+		end64 := binary.LittleEndian.AppendUint32(nil, directory64EndSignature)
+		end64 = binary.LittleEndian.AppendUint64(end64, directory64EndLen-12)
+		end64 = binary.LittleEndian.AppendUint16(end64, 45)
+		end64 = binary.LittleEndian.AppendUint16(end64, 45)
+		end64 = binary.LittleEndian.AppendUint32(end64, uint32(end64Disk))
+		end64 = binary.LittleEndian.AppendUint32(end64, uint32(dirDisk))
+		end64 = binary.LittleEndian.AppendUint64(end64, uint64(records))
+		end64 = binary.LittleEndian.AppendUint64(end64, uint64(records))
+		end64 = binary.LittleEndian.AppendUint64(end64, uint64(dirSize))
+		end64 = binary.LittleEndian.AppendUint64(end64, uint64(dirOffset))
+		loc := binary.LittleEndian.AppendUint32(nil, directory64LocSignature)
+		loc = binary.LittleEndian.AppendUint32(loc, uint32(end64Disk))
+		loc = binary.LittleEndian.AppendUint64(loc, uint64(end64Offset))
+		loc = binary.LittleEndian.AppendUint32(loc, 3)
+		end := bytes.Clone(data[endOffset:])
+		binary.LittleEndian.PutUint16(end[4:], 0xffff)
+		binary.LittleEndian.PutUint16(end[6:], 0xffff)
+		binary.LittleEndian.PutUint16(end[8:], 0xffff)
+		binary.LittleEndian.PutUint16(end[10:], 0xffff)
+		binary.LittleEndian.PutUint32(end[12:], 0xffffffff)
+		binary.LittleEndian.PutUint32(end[16:], 0xffffffff)
+		data = append(append(append(data[:endOffset], end64...), loc...), end...)
+	} else {
+		binary.LittleEndian.PutUint16(data[endOffset+4:], 2)
+		binary.LittleEndian.PutUint16(data[endOffset+6:], uint16(dirDisk))
+		binary.LittleEndian.PutUint32(data[endOffset+16:], uint32(dirOffset))
+	}
+
+	paths := []string{
+		filePath[:len(filePath)-2] + "01",
+		filePath[:len(filePath)-2] + "02",
+		filePath,
+	}
+	for i, path := range paths {
+		volume := data[i*volumeSize:]
+		if i < 2 {
+			volume = volume[:volumeSize]
+		}
+		require.NoError(t, os.WriteFile(path, volume, 0644))
+	}
+	return filePath, paths
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/binalyze/biunzip/internal/zip"
+)
+
+const xattrPrefix = "user.biunzip."
+
+var errXattrsUnsupported = errors.New("extended attributes are not supported")
+
+type xattrSource struct {
+	filePath    string
+	sha256      string
+	opts        unzipOptions
+	unsupported bool
+}
+
+// newXattrSource tags the files with the absolute path of the zip file, or
+// with its name if it is read from a temp file, e.g. stdin.
+func newXattrSource(ctx context.Context, source zipSource, opts unzipOptions) (*xattrSource, error) {
+	if !opts.xattrs {
+		return nil, nil
+	}
+	filePath := source.name
+	if source.reader != nil || source.name == source.path {
+		absFilePath, err := filepath.Abs(source.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find absolute path of '%s': %w", source.name, err)
+		}
+		filePath = absFilePath
+	}
+	var hash string
+	var err error
+	if source.reader != nil {
+		hash, err = hashReader(ctx, io.NewSectionReader(source.reader, 0, source.size), source.name)
+	} else {
+		hash, err = hashVolumes(ctx, source.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	xattrs := &xattrSource{
+		filePath: filePath,
+		sha256:   hash,
+		opts:     opts,
+	}
+	return xattrs, nil
+}
+
+// hashVolumes hashes the volumes of a split zip file in order, which is the
+// hash of the zip file itself if it isn't split.
+func hashVolumes(ctx context.Context, filePath string) (string, error) {
+	paths, _, err := findVolumePaths(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find volumes of '%s': %w", filePath, err)
+	}
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open file '%s': %w", path, err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+	return hashReader(ctx, io.MultiReader(readers...), filePath)
+}
+
+// tag writes the provenance of the file as extended attributes, with the entry
+// name stored in the zip file rather than the rewritten one. If the file
+// system doesn't support them, a warning is printed once and the remaining
+// files of the zip file are not tagged.
+func (s *xattrSource) tag(file *os.File, zipEntry *zip.File, rawName string) error {
+	if s == nil || s.unsupported {
+		return nil
+	}
+	attrs := []struct {
+		name  string
+		value string
+	}{
+		{"source_path", s.filePath},
+		{"source_sha256", s.sha256},
+		{"entry_name", rawName},
+		{"entry_crc32", fmt.Sprintf("%08x", zipEntry.CRC32)},
+		{"extracted_at", time.Now().UTC().Format(time.RFC3339)},
+	}
+	for _, attr := range attrs {
+		err := setXattr(file, xattrPrefix+attr.name, attr.value)
+		if errors.Is(err, errXattrsUnsupported) {
+			s.unsupported = true
+			s.opts.logf("warning: %s for the files unzipped from %s\n", err, s.filePath)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set extended attribute '%s' of '%s': %w", xattrPrefix+attr.name, file.Name(), err)
+		}
+	}
+	return nil
+}
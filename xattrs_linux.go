@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func setXattr(file *os.File, name string, value string) error {
+	err := unix.Fsetxattr(int(file.Fd()), name, []byte(value), 0)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return errXattrsUnsupported
+	}
+	return err
+}
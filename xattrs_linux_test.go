@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestUnzipFileWithXattrs(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "dir_1/file_1.txt", content: "content_1"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		xattrs:    true,
+		logWriter: &logs,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	if strings.Contains(logs.String(), "warning: "+errXattrsUnsupported.Error()) {
+		t.Skip("extended attributes are not supported by the temp dir")
+	}
+
+	hash, err := hashFile(context.Background(), filePath)
+	require.NoError(t, err)
+	dstPath := filepath.Join(makeDirPath(filePath), "dir_1", "file_1.txt")
+	expected := map[string]string{
+		"source_path":   filePath,
+		"source_sha256": hash,
+		"entry_name":    "dir_1/file_1.txt",
+		"entry_crc32":   fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte("content_1"))),
+	}
+	for name, value := range expected {
+		require.Equal(t, value, getXattr(t, dstPath, xattrPrefix+name), name)
+	}
+	require.NotEmpty(t, getXattr(t, dstPath, xattrPrefix+"extracted_at"))
+}
+
+func TestUnzipFileWithXattrsAndPortableNames(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "dir_1/what?.txt", content: "content_1"},
+	}
+	filePath := createTestZipFile(t, entries, "")
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		xattrs:        true,
+		portableNames: true,
+		logWriter:     &logs,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	if strings.Contains(logs.String(), "warning: "+errXattrsUnsupported.Error()) {
+		t.Skip("extended attributes are not supported by the temp dir")
+	}
+
+	dstPath := filepath.Join(makeDirPath(filePath), "dir_1", "what_.txt")
+	require.Equal(t, "dir_1/what?.txt", getXattr(t, dstPath, xattrPrefix+"entry_name"))
+}
+
+func TestUnzipStdinWithXattrs(t *testing.T) {
+	entries := []testZipEntry{
+		{name: "dir_1/file_1.txt", content: "content_1"},
+	}
+	data, err := os.ReadFile(createTestZipFile(t, entries, ""))
+	require.NoError(t, err)
+	t.Chdir(t.TempDir())
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		xattrs:    true,
+		logWriter: &logs,
+	}
+	err = unzipStdin(context.Background(), bytes.NewReader(data), "", opts)
+	require.NoError(t, err)
+	if strings.Contains(logs.String(), "warning: "+errXattrsUnsupported.Error()) {
+		t.Skip("extended attributes are not supported by the temp dir")
+	}
+	require.Contains(t, logs.String(), "unzipping stdin...")
+	require.Contains(t, logs.String(), "unzipped stdin:")
+
+	dstPath := filepath.Join(makeDirPath(stdinName), "dir_1", "file_1.txt")
+	require.Equal(t, stdinName, getXattr(t, dstPath, xattrPrefix+"source_path"))
+	require.Equal(t, fmt.Sprintf("%x", sha256.Sum256(data)), getXattr(t, dstPath, xattrPrefix+"source_sha256"))
+}
+
+func TestUnzipFileWithXattrsAndSplitVolumes(t *testing.T) {
+	_, volumePaths := createSpannedTestZipFile(t)
+	filePath := volumePaths[len(volumePaths)-1]
+	var logs bytes.Buffer
+	opts := unzipOptions{
+		xattrs:    true,
+		logWriter: &logs,
+	}
+	err := unzipFile(context.Background(), filePath, "", opts)
+	require.NoError(t, err)
+	if strings.Contains(logs.String(), "warning: "+errXattrsUnsupported.Error()) {
+		t.Skip("extended attributes are not supported by the temp dir")
+	}
+
+	hash := sha256.New()
+	for _, path := range volumePaths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		hash.Write(data)
+	}
+	dstPath := filepath.Join(makeDirPath(filePath), "files", "readme.txt")
+	require.Equal(t, fmt.Sprintf("%x", hash.Sum(nil)), getXattr(t, dstPath, xattrPrefix+"source_sha256"))
+}
+
+func getXattr(t *testing.T, path string, name string) string {
+	t.Helper()
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(path, name, buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+func setXattr(file *os.File, name string, value string) error {
+	return errXattrsUnsupported
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const zip64ExtraID = 0x0001
+
+var errInvalidZip64Extra = errors.New("invalid zip64 extra field")
+
+func readZip64Field(data []byte) (uint64, []byte, error) {
+	if len(data) < 8 {
+		return 0, nil, errInvalidZip64Extra
+	}
+	return binary.LittleEndian.Uint64(data), data[8:], nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// zip64TestEntrySize is just above 4GB, so the entry needs zip64 sizes and
+// the following entry a zip64 offset.
+const zip64TestEntrySize = math.MaxUint32 + 1<<20
+
+func TestUnzipFileWithZip64(t *testing.T) {
+	skipWithoutHeavyTests(t)
+	filePath := createZip64TestFile(t)
+
+	err := unzipFile(context.Background(), filePath, "", unzipOptions{logWriter: &bytes.Buffer{}})
+	require.NoError(t, err)
+	dirPath := makeDirPath(filePath)
+	fileInfo, err := os.Stat(filepath.Join(dirPath, "memory.raw"))
+	require.NoError(t, err)
+	require.Equal(t, int64(zip64TestEntrySize), fileInfo.Size())
+	content, err := os.ReadFile(filepath.Join(dirPath, "after.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "after", string(content))
+
+	counter := &countWriter{}
+	err = catEntry(context.Background(), counter, filePath, "", "memory.raw", nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(zip64TestEntrySize), counter.count)
+}
+
+// skipWithoutHeavyTests skips the tests reading gigabytes, which are only run
+// when BIUNZIP_HEAVY_TESTS is set.
+func skipWithoutHeavyTests(t *testing.T) {
+	t.Helper()
+	if len(os.Getenv("BIUNZIP_HEAVY_TESTS")) == 0 || testing.Short() {
+		t.Skip("set BIUNZIP_HEAVY_TESTS to run the heavy tests")
+	}
+}
+
+// createZip64TestFile creates a sparse zip file with a stored entry of zeros
+// larger than 4GB written with a data descriptor, followed by a small entry.
+func createZip64TestFile(t *testing.T) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "test.zip")
+	file, err := os.Create(filePath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	writer := zip.NewWriter(&sparseWriter{file: file})
+	entryWriter, err := writer.CreateHeader(&zip.FileHeader{Name: "memory.raw", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = io.CopyN(entryWriter, zeroReader{}, zip64TestEntrySize)
+	require.NoError(t, err)
+	entryWriter, err = writer.Create("after.txt")
+	require.NoError(t, err)
+	_, err = entryWriter.Write([]byte("after"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return filePath
+}
+
+// sparseWriter seeks over the zeros instead of writing them.
+type sparseWriter struct {
+	file *os.File
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != 0 {
+			return w.file.Write(p)
+		}
+	}
+	_, err := w.file.Seek(int64(len(p)), io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+type countWriter struct {
+	count int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}